@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE IF EXISTS public.photos
+    ADD COLUMN medium_url text NOT NULL DEFAULT '';
+
+-- photos uploaded before renditions existed only have the original
+UPDATE public.photos
+SET medium_url = url;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.photos
+    DROP COLUMN IF EXISTS medium_url;
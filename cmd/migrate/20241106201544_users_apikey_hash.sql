@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE IF EXISTS public.users
+    RENAME COLUMN apikey TO apikey_hash;
+
+ALTER TABLE IF EXISTS public.users
+    ALTER COLUMN apikey_hash DROP DEFAULT,
+    ALTER COLUMN apikey_hash DROP NOT NULL;
+
+-- keys are only stored hashed from now on, existing keys keep working
+UPDATE public.users
+SET apikey_hash = encode(sha256(apikey_hash::bytea), 'hex');
+
+-- +goose Down
+-- hashed keys can't be recovered, revoked users get a random one
+UPDATE public.users
+SET apikey_hash = encode(sha256(random()::text::bytea), 'hex')
+WHERE apikey_hash IS NULL;
+
+ALTER TABLE IF EXISTS public.users
+    ALTER COLUMN apikey_hash SET DEFAULT encode(sha256(random()::text::bytea), 'hex'),
+    ALTER COLUMN apikey_hash SET NOT NULL;
+
+ALTER TABLE IF EXISTS public.users
+    RENAME COLUMN apikey_hash TO apikey;
@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE public.family_invites
+(
+    id bigserial,
+    token_hash text NOT NULL UNIQUE,
+    family_id bigint NOT NULL,
+    created_by text NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    expires_at timestamp without time zone NOT NULL,
+    used_at timestamp without time zone,
+    used_by text,
+    PRIMARY KEY (id)
+);
+
+ALTER TABLE IF EXISTS public.family_invites
+    ADD CONSTRAINT family_id_fkey FOREIGN KEY (family_id)
+    REFERENCES public.families (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE CASCADE;
+
+ALTER TABLE IF EXISTS public.family_invites
+    ADD CONSTRAINT created_by_fkey FOREIGN KEY (created_by)
+    REFERENCES public.users (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE CASCADE;
+
+ALTER TABLE IF EXISTS public.family_invites
+    ADD CONSTRAINT used_by_fkey FOREIGN KEY (used_by)
+    REFERENCES public.users (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE SET NULL;
+
+-- +goose Down
+DROP TABLE public.family_invites;
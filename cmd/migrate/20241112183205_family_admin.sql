@@ -0,0 +1,30 @@
+-- +goose Up
+-- the admin user migration inserted family 1 without advancing the sequence
+SELECT setval('public.families_id_seq', COALESCE((SELECT MAX(id) FROM public.families), 0) + 1, false);
+
+ALTER TABLE IF EXISTS public.families
+    ADD COLUMN admin_user_id text;
+
+ALTER TABLE IF EXISTS public.families
+    ADD CONSTRAINT admin_user_id_fkey FOREIGN KEY (admin_user_id)
+    REFERENCES public.users (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE SET NULL;
+
+-- the longest standing member of each family becomes its admin
+UPDATE public.families AS f
+SET admin_user_id = (
+    SELECT u.id FROM public.users AS u
+        WHERE u.family_id = f.id
+        ORDER BY u.created_at ASC
+        LIMIT 1
+);
+
+-- members removed from a family are left without one
+ALTER TABLE IF EXISTS public.users
+    ALTER COLUMN family_id DROP DEFAULT,
+    ALTER COLUMN family_id DROP NOT NULL;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.families
+    DROP COLUMN IF EXISTS admin_user_id;
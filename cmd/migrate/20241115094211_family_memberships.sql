@@ -0,0 +1,50 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.family_memberships
+(
+    user_id text NOT NULL,
+    family_id bigint NOT NULL,
+    role text NOT NULL DEFAULT 'member',
+    created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT family_memberships_pkey PRIMARY KEY (user_id, family_id),
+    CONSTRAINT family_memberships_role_check CHECK (role IN ('admin', 'member')),
+    CONSTRAINT user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT family_id_fkey FOREIGN KEY (family_id)
+        REFERENCES public.families (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS family_memberships_family_id_idx
+    ON public.family_memberships (family_id);
+
+-- everyone keeps the family they are in, users.family_id is now the family they are looking at
+INSERT INTO public.family_memberships (user_id, family_id, role, created_at)
+SELECT u.id, u.family_id, CASE WHEN f.admin_user_id = u.id THEN 'admin' ELSE 'member' END, u.created_at
+    FROM public.users AS u
+    JOIN public.families AS f ON u.family_id = f.id;
+
+ALTER TABLE IF EXISTS public.families
+    DROP COLUMN IF EXISTS admin_user_id;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.families
+    ADD COLUMN admin_user_id text;
+
+ALTER TABLE IF EXISTS public.families
+    ADD CONSTRAINT admin_user_id_fkey FOREIGN KEY (admin_user_id)
+    REFERENCES public.users (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE SET NULL;
+
+UPDATE public.families AS f
+SET admin_user_id = (
+    SELECT m.user_id FROM public.family_memberships AS m
+        WHERE m.family_id = f.id AND m.role = 'admin'
+        ORDER BY m.created_at ASC
+        LIMIT 1
+);
+
+DROP TABLE IF EXISTS public.family_memberships;
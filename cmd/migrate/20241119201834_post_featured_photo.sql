@@ -0,0 +1,27 @@
+-- +goose Up
+-- deleting the featured photo used to cascade to the whole post and the rest of its photos
+ALTER TABLE IF EXISTS public.posts
+    DROP CONSTRAINT IF EXISTS featured_photo_id_fkey;
+
+ALTER TABLE IF EXISTS public.posts
+    ADD CONSTRAINT featured_photo_id_fkey FOREIGN KEY (featured_photo_id)
+    REFERENCES public.photos (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE SET NULL;
+
+ALTER TABLE IF EXISTS public.posts
+    ALTER COLUMN description SET DEFAULT '';
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.posts
+    ALTER COLUMN description DROP DEFAULT;
+
+ALTER TABLE IF EXISTS public.posts
+    DROP CONSTRAINT IF EXISTS featured_photo_id_fkey;
+
+ALTER TABLE IF EXISTS public.posts
+    ADD CONSTRAINT featured_photo_id_fkey FOREIGN KEY (featured_photo_id)
+    REFERENCES public.photos (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE CASCADE
+    NOT VALID;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- the feed pages through a family's posts newest first
+CREATE INDEX IF NOT EXISTS posts_family_id_created_at_idx
+    ON public.posts (family_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS public.posts_family_id_created_at_idx;
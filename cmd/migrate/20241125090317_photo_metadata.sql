@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS public.photo_metadata
+(
+    photo_id text NOT NULL,
+    taken_at timestamp without time zone,
+    camera_make text NOT NULL DEFAULT '',
+    camera_model text NOT NULL DEFAULT '',
+    lens_model text NOT NULL DEFAULT '',
+    exposure_time text NOT NULL DEFAULT '',
+    f_number double precision,
+    iso integer,
+    focal_length double precision,
+    latitude double precision,
+    longitude double precision,
+    orientation integer,
+    CONSTRAINT photo_metadata_pkey PRIMARY KEY (photo_id),
+    CONSTRAINT photo_id_fkey FOREIGN KEY (photo_id)
+        REFERENCES public.photos (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS public.photo_metadata;
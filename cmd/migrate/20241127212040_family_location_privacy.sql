@@ -0,0 +1,14 @@
+-- +goose Up
+-- what happens to GPS tags in the originals family members can download
+ALTER TABLE IF EXISTS public.families
+    ADD COLUMN location_exif text NOT NULL DEFAULT 'strip',
+    ADD CONSTRAINT families_location_exif_check CHECK (location_exif IN ('keep', 'coarsen', 'strip'));
+
+-- whether the exact position is kept in photo_metadata for the family's own use
+ALTER TABLE IF EXISTS public.families
+    ADD COLUMN keep_locations boolean NOT NULL DEFAULT TRUE;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.families
+    DROP COLUMN IF EXISTS keep_locations,
+    DROP COLUMN IF EXISTS location_exif;
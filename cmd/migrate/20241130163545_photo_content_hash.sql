@@ -0,0 +1,22 @@
+-- +goose Up
+-- sha256 of the stored original, uploads with the same hash in a family share one set of blobs
+ALTER TABLE IF EXISTS public.photos
+    ADD COLUMN content_hash text;
+
+CREATE INDEX IF NOT EXISTS photos_content_hash_idx
+    ON public.photos (content_hash);
+
+-- shared blobs mean several photos can point at the same urls
+ALTER TABLE IF EXISTS public.photos
+    DROP CONSTRAINT IF EXISTS photos_url_key,
+    DROP CONSTRAINT IF EXISTS photos_thumb_url_key;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.photos
+    ADD CONSTRAINT photos_url_key UNIQUE (url),
+    ADD CONSTRAINT photos_thumb_url_key UNIQUE (thumb_url);
+
+DROP INDEX IF EXISTS photos_content_hash_idx;
+
+ALTER TABLE IF EXISTS public.photos
+    DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- 64 bit difference hash of the image, near duplicates differ in only a few bits
+ALTER TABLE IF EXISTS public.photos
+    ADD COLUMN perceptual_hash bigint;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.photos
+    DROP COLUMN IF EXISTS perceptual_hash;
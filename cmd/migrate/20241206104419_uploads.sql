@@ -0,0 +1,42 @@
+-- +goose Up
+-- resumable uploads in progress, the bytes received so far are kept on disk
+CREATE TABLE IF NOT EXISTS public.uploads
+(
+    id text NOT NULL,
+    user_id text NOT NULL,
+    family_id bigint NOT NULL,
+    length bigint NOT NULL,
+    batch text NOT NULL,
+    caption text NOT NULL DEFAULT '',
+    filename text NOT NULL DEFAULT '',
+    created_at timestamp without time zone NOT NULL DEFAULT NOW(),
+    expires_at timestamp without time zone NOT NULL,
+    completed_at timestamp without time zone,
+    CONSTRAINT uploads_pkey PRIMARY KEY (id),
+    CONSTRAINT user_id_fkey FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT family_id_fkey FOREIGN KEY (family_id)
+        REFERENCES public.families (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS uploads_expires_at_idx
+    ON public.uploads (expires_at);
+
+-- uploads sent with the same batch end up in one post, whichever finishes first creates it
+ALTER TABLE IF EXISTS public.posts
+    ADD COLUMN upload_batch text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS posts_upload_batch_key
+    ON public.posts (user_id, upload_batch);
+
+-- +goose Down
+DROP INDEX IF EXISTS posts_upload_batch_key;
+
+ALTER TABLE IF EXISTS public.posts
+    DROP COLUMN IF EXISTS upload_batch;
+
+DROP TABLE IF EXISTS public.uploads;
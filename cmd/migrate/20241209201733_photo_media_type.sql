@@ -0,0 +1,14 @@
+-- +goose Up
+-- videos are stored alongside photos, their thumbnail and medium renditions are a poster frame
+ALTER TABLE IF EXISTS public.photos
+    ADD COLUMN media_type text NOT NULL DEFAULT 'image' CHECK (media_type IN ('image', 'video')),
+    ADD COLUMN width integer,
+    ADD COLUMN height integer,
+    ADD COLUMN duration_ms integer;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.photos
+    DROP COLUMN IF EXISTS duration_ms,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS media_type;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- PDFs become documents, their thumbnail is a preview of the first page when one could be made
+ALTER TABLE IF EXISTS public.photos
+    DROP CONSTRAINT IF EXISTS photos_media_type_check,
+    ADD CONSTRAINT photos_media_type_check CHECK (media_type IN ('image', 'video', 'document'));
+
+-- documents uploaded before this have no preview, their thumbnail is the PDF itself
+UPDATE photos SET media_type = 'document' WHERE url LIKE '%.pdf';
+
+-- +goose Down
+UPDATE photos SET media_type = 'image' WHERE media_type = 'document';
+
+ALTER TABLE IF EXISTS public.photos
+    DROP CONSTRAINT IF EXISTS photos_media_type_check,
+    ADD CONSTRAINT photos_media_type_check CHECK (media_type IN ('image', 'video'));
@@ -0,0 +1,9 @@
+-- +goose Up
+-- size of the stored original in bytes, for the family storage quota. Photos from before are unknown
+-- and don't count towards it.
+ALTER TABLE IF EXISTS public.photos
+    ADD COLUMN size bigint;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.photos
+    DROP COLUMN IF EXISTS size;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- deleted photos and posts stay in the trash for 30 days, then they are purged along with their files
+ALTER TABLE IF EXISTS public.photos
+    ADD COLUMN deleted_at timestamp;
+
+ALTER TABLE IF EXISTS public.posts
+    ADD COLUMN deleted_at timestamp;
+
+CREATE INDEX photos_deleted_at_idx ON public.photos (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX posts_deleted_at_idx ON public.posts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS posts_deleted_at_idx;
+
+DROP INDEX IF EXISTS photos_deleted_at_idx;
+
+ALTER TABLE IF EXISTS public.posts
+    DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE IF EXISTS public.photos
+    DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- the order the owner arranged a post's photos in, photos never moved are shown after them by when they were taken
+ALTER TABLE IF EXISTS public.photos
+    ADD COLUMN sort_order integer;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.photos
+    DROP COLUMN IF EXISTS sort_order;
@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE public.comments
+(
+    id bigserial,
+    post_id bigint NOT NULL,
+    user_id text NOT NULL,
+    body text NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (id)
+);
+
+ALTER TABLE IF EXISTS public.comments
+    ADD CONSTRAINT post_id_fkey FOREIGN KEY (post_id)
+    REFERENCES public.posts (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE CASCADE;
+
+ALTER TABLE IF EXISTS public.comments
+    ADD CONSTRAINT user_id_fkey FOREIGN KEY (user_id)
+    REFERENCES public.users (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE CASCADE;
+
+-- comments are listed and counted by post, oldest first
+CREATE INDEX comments_post_id_created_at_idx ON public.comments (post_id, created_at);
+
+-- +goose Down
+DROP TABLE public.comments;
@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE public.reactions
+(
+    id bigserial,
+    post_id bigint,
+    photo_id text,
+    user_id text NOT NULL,
+    emoji text NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (id),
+    -- a reaction is to either a post or one of its photos
+    CONSTRAINT reactions_target_check CHECK (num_nonnulls(post_id, photo_id) = 1)
+);
+
+ALTER TABLE IF EXISTS public.reactions
+    ADD CONSTRAINT post_id_fkey FOREIGN KEY (post_id)
+    REFERENCES public.posts (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE CASCADE;
+
+ALTER TABLE IF EXISTS public.reactions
+    ADD CONSTRAINT photo_id_fkey FOREIGN KEY (photo_id)
+    REFERENCES public.photos (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE CASCADE;
+
+ALTER TABLE IF EXISTS public.reactions
+    ADD CONSTRAINT user_id_fkey FOREIGN KEY (user_id)
+    REFERENCES public.users (id) MATCH SIMPLE
+    ON UPDATE NO ACTION
+    ON DELETE CASCADE;
+
+-- each person reacts with an emoji once per post or photo
+CREATE UNIQUE INDEX reactions_post_user_emoji_idx ON public.reactions (post_id, user_id, emoji) WHERE post_id IS NOT NULL;
+
+CREATE UNIQUE INDEX reactions_photo_user_emoji_idx ON public.reactions (photo_id, user_id, emoji) WHERE photo_id IS NOT NULL;
+
+-- +goose Down
+DROP TABLE public.reactions;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- the bytes of an upload are kept in storage as one object per chunk, with how far it got kept here so
+-- any instance can carry on with it
+ALTER TABLE IF EXISTS public.uploads
+    ADD COLUMN upload_offset bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE IF EXISTS public.uploads
+    ADD COLUMN chunks text[] NOT NULL DEFAULT '{}';
+
+-- uploads started on the local disk can't be resumed from storage
+DELETE FROM public.uploads
+WHERE completed_at IS NULL;
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.uploads
+    DROP COLUMN IF EXISTS chunks;
+
+ALTER TABLE IF EXISTS public.uploads
+    DROP COLUMN IF EXISTS upload_offset;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- people log in by name, two signups racing for the same one are stopped here
+ALTER TABLE IF EXISTS public.users
+    ADD CONSTRAINT users_name_key UNIQUE (name);
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.users
+    DROP CONSTRAINT IF EXISTS users_name_key;
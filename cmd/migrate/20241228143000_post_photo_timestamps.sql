@@ -0,0 +1,19 @@
+-- +goose Up
+-- posts and photos are stamped by the database, so the feed order doesn't depend on the clock of the
+-- instance that took the upload
+ALTER TABLE IF EXISTS public.posts
+    ALTER COLUMN created_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET DEFAULT NOW();
+
+ALTER TABLE IF EXISTS public.photos
+    ALTER COLUMN created_at SET DEFAULT NOW(),
+    ALTER COLUMN updated_at SET DEFAULT NOW();
+
+-- +goose Down
+ALTER TABLE IF EXISTS public.photos
+    ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN created_at DROP DEFAULT;
+
+ALTER TABLE IF EXISTS public.posts
+    ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN created_at DROP DEFAULT;
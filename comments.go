@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/donseba/go-htmx"
+	"github.com/jackc/pgx/v5"
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/rowinf/phamily-photos/internal/database"
+)
+
+const maxCommentLength = 2000
+
+var (
+	errEmptyComment   = errors.New("EMPTY_COMMENT")
+	errCommentTooLong = errors.New("COMMENT_TOO_LONG")
+)
+
+// readCommentBody is the trimmed comment from the form, it can't be empty or too long
+func readCommentBody(r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	body := strings.TrimSpace(r.PostForm.Get("body"))
+	if body == "" {
+		return "", errEmptyComment
+	}
+	if len(body) > maxCommentLength {
+		return "", errCommentTooLong
+	}
+	return body, nil
+}
+
+// familyComment finds a comment on the post in the path, it is not found outside the user's selected family
+func (a *App) familyComment(r *http.Request, user database.User) (database.GetFamilyCommentRow, error) {
+	postID, err := strconv.ParseInt(r.PathValue("postID"), 10, 64)
+	if err != nil {
+		return database.GetFamilyCommentRow{}, pgx.ErrNoRows
+	}
+	commentID, err := strconv.ParseInt(r.PathValue("commentID"), 10, 64)
+	if err != nil {
+		return database.GetFamilyCommentRow{}, pgx.ErrNoRows
+	}
+	comment, err := a.DB.GetFamilyComment(r.Context(), database.GetFamilyCommentParams{
+		ID:       commentID,
+		FamilyID: user.FamilyID.Int64,
+		UserID:   user.ID,
+	})
+	if err == nil && comment.PostID != postID {
+		return database.GetFamilyCommentRow{}, pgx.ErrNoRows
+	}
+	return comment, err
+}
+
+// renderComments shows the comments under a post with the form to add one
+func (a *App) renderComments(w http.ResponseWriter, r *http.Request, user database.User, postID int64) {
+	h := a.htmx.NewHandler(w, r)
+	comments, err := a.DB.GetPostComments(r.Context(), database.GetPostCommentsParams{
+		PostID: postID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data := map[string]any{
+		"PostID":   postID,
+		"Comments": comments,
+	}
+	component := htmx.NewComponent("views/comments.html", "views/comment.html").SetData(data)
+	component.AddTemplateFunction("formatDate", formatDate)
+	if _, err := h.Render(r.Context(), component); err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+func (a *App) renderComment(w http.ResponseWriter, r *http.Request, tpl string, comment database.GetFamilyCommentRow) {
+	h := a.htmx.NewHandler(w, r)
+	component := htmx.NewComponent(tpl).SetData(map[string]any{"Comment": comment})
+	component.AddTemplateFunction("formatDate", formatDate)
+	if _, err := h.Render(r.Context(), component); err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+// CommentsGet lists the comments on a post in the user's family
+func (a *App) CommentsGet(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, err := a.familyPost(r, user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(a.htmx.NewHandler(w, r), w, http.StatusNotFound, "not found")
+		return
+	}
+	a.renderComments(w, r, user, post.PostID)
+}
+
+// CommentCreate adds the user's comment to a post in their family
+func (a *App) CommentCreate(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	post, err := a.familyPost(r, user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	body, err := readCommentBody(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	_, err = a.DB.CreateComment(r.Context(), database.CreateCommentParams{
+		PostID: post.PostID,
+		UserID: user.ID,
+		Body:   body,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.renderComments(w, r, user, post.PostID)
+}
+
+// CommentGet shows one comment, putting it back in place of its editor
+func (a *App) CommentGet(w http.ResponseWriter, r *http.Request, user database.User) {
+	comment, err := a.familyComment(r, user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(a.htmx.NewHandler(w, r), w, http.StatusNotFound, "not found")
+		return
+	}
+	a.renderComment(w, r, "views/comment.html", comment)
+}
+
+// CommentEdit swaps one of the user's comments for a form to change it
+func (a *App) CommentEdit(w http.ResponseWriter, r *http.Request, user database.User) {
+	comment, err := a.familyComment(r, user)
+	if err != nil || !comment.IsMyComment {
+		internal.RespondWithErrorHtmx(a.htmx.NewHandler(w, r), w, http.StatusNotFound, "not found")
+		return
+	}
+	a.renderComment(w, r, "views/comment-edit.html", comment)
+}
+
+// CommentUpdate changes one of the user's comments, only the person who wrote it can
+func (a *App) CommentUpdate(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	comment, err := a.familyComment(r, user)
+	if err != nil || !comment.IsMyComment {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	body, err := readCommentBody(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	updated, err := a.DB.UpdateComment(r.Context(), database.UpdateCommentParams{
+		ID:     comment.ID,
+		UserID: user.ID,
+		Body:   body,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	comment.Body = updated.Body
+	comment.UpdatedAt = updated.UpdatedAt
+	a.renderComment(w, r, "views/comment.html", comment)
+}
+
+// CommentDelete removes a comment, by the person who wrote it or the owner of the post it is on
+func (a *App) CommentDelete(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	comment, err := a.familyComment(r, user)
+	if err != nil || !(comment.IsMyComment || comment.IsMyPost) {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	if err := a.DB.DeleteComment(r.Context(), comment.ID); err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.renderComments(w, r, user, comment.PostID)
+}
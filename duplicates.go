@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/donseba/go-htmx"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/rowinf/phamily-photos/internal/database"
+)
+
+// photoRemovedEvent is triggered on htmx responses that delete a photo
+const photoRemovedEvent = "photoRemoved"
+
+const duplicatesPageSize = 50
+
+var errMergeIntoSelf = errors.New("MERGE_INTO_SELF")
+
+// duplicatesPage loads a page of look-alike pairs, starting after the cursor when there is one.
+// next is empty on the last page.
+func (a *App) duplicatesPage(ctx context.Context, user database.User, after string) (pairs []database.GetFamilyNearDuplicatesRow, next string, err error) {
+	params := database.GetFamilyNearDuplicatesParams{
+		UserID:      user.ID,
+		FamilyID:    user.FamilyID.Int64,
+		MaxDistance: internal.NearDuplicateDistance,
+		Limit:       duplicatesPageSize + 1,
+	}
+	if after != "" {
+		cursor, err := internal.ParsePairCursor(after)
+		if err != nil {
+			return nil, "", err
+		}
+		params.AfterDistance = pgtype.Int4{Int32: cursor.Distance, Valid: true}
+		params.AfterCreatedAt = pgtype.Timestamp{Time: cursor.CreatedAt, Valid: true}
+		params.AfterPhotoID = pgtype.Text{String: cursor.PhotoID, Valid: true}
+		params.AfterOtherPhotoID = pgtype.Text{String: cursor.OtherPhotoID, Valid: true}
+	}
+	pairs, err = a.DB.GetFamilyNearDuplicates(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+	// the extra row only tells us there is another page
+	if len(pairs) > duplicatesPageSize {
+		pairs = pairs[:duplicatesPageSize]
+		last := pairs[len(pairs)-1]
+		next = internal.PairCursor{
+			Distance:     last.Distance,
+			CreatedAt:    last.CreatedAt.Time,
+			PhotoID:      last.PhotoID,
+			OtherPhotoID: last.OtherPhotoID,
+		}.String()
+	}
+	return pairs, next, nil
+}
+
+// PhotoDuplicates lists pairs of photos in the family that look alike, so their owners can tidy them up
+func (a *App) PhotoDuplicates(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	after := r.URL.Query().Get("after")
+	pairs, next, err := a.duplicatesPage(r.Context(), user, after)
+	if errors.Is(err, internal.ErrInvalidCursor) {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data := map[string]any{
+		"Pairs":      pairs,
+		"NextCursor": next,
+	}
+	// scrolling to the end asks for the next page with htmx and appends it in place of the loader
+	if after != "" && h.IsHxRequest() && !h.IsHxBoosted() {
+		component := htmx.NewComponent("views/photo-duplicates-page.html").SetData(data)
+		component.AddTemplateFunction("formatDate", formatDate)
+		if _, err := h.Render(r.Context(), component); err != nil {
+			fmt.Printf("error rendering page: %v", err.Error())
+		}
+		return
+	}
+	component := htmx.NewComponent("views/photo-duplicates.html", "views/photo-duplicates-page.html").SetData(data)
+	component.AddTemplateFunction("formatDate", formatDate)
+	// the list reloads itself after a photo is removed, anything else gets the whole page
+	page := component
+	if !h.IsHxRequest() || h.IsHxBoosted() {
+		page = mainContentWithNavbar("Phamily Photos Duplicates", a.navbarWithUser(r.Context(), user))
+		page.With(component, "Content")
+	}
+	_, err = h.Render(r.Context(), page)
+	if err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+// PhotoMerge moves one of the user's photos to the trash in favour of a look-alike, which takes a copy of
+// its camera details when it has none of its own
+func (a *App) PhotoMerge(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	photo, err := a.DB.GetPhoto(r.Context(), database.GetPhotoParams{
+		ID:     r.PathValue("photoID"),
+		UserID: user.ID,
+	})
+	if err != nil || !photo.IsMyPhoto {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	into, err := a.DB.GetFamilyPhoto(r.Context(), database.GetFamilyPhotoParams{
+		ID:       r.PostForm.Get("into"),
+		FamilyID: user.FamilyID.Int64,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	if into.ID == photo.ID {
+		internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, errMergeIntoSelf.Error())
+		return
+	}
+
+	// the merged photo goes to the trash like any other, its files stay until the trash is purged
+	err = a.withTx(r.Context(), func(txq *database.Queries) error {
+		err := txq.CopyPhotoMetadata(r.Context(), database.CopyPhotoMetadataParams{
+			IntoID:  into.ID,
+			PhotoID: photo.ID,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = txq.TrashPhoto(r.Context(), database.TrashPhotoParams{
+			ID:     photo.ID,
+			UserID: user.ID,
+		})
+		return err
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.Trigger(photoRemovedEvent)
+	h.TriggerInfo("The photo was moved to the trash, it can be restored for 30 days")
+	internal.RespondWithOk(w)
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donseba/go-htmx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/rowinf/phamily-photos/internal/database"
+)
+
+// roles a user can have in each family they belong to
+const (
+	roleAdmin  = "admin"
+	roleMember = "member"
+)
+
+var (
+	errNotFamilyAdmin  = errors.New("only the family admin can do that")
+	errNotFamilyMember = errors.New("not a member of this family")
+	errAdminMustStay   = errors.New("transfer the admin role to another member first")
+)
+
+type FamilyParams struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// the location settings are left as they are when missing
+	LocationExif  string `json:"location_exif"`
+	KeepLocations *bool  `json:"keep_locations"`
+}
+
+type FamilyAdminParams struct {
+	UserId string `json:"user_id"`
+}
+
+type FamilySelectParams struct {
+	FamilyId int64 `json:"family_id"`
+}
+
+type FamilyMemberResponse struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	IsAdmin   bool   `json:"is_admin"`
+}
+
+type FamilyResponse struct {
+	Id            int64                  `json:"id"`
+	CreatedAt     string                 `json:"created_at"`
+	UpdatedAt     string                 `json:"updated_at"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description"`
+	LocationExif  string                 `json:"location_exif"`
+	KeepLocations bool                   `json:"keep_locations"`
+	Members       []FamilyMemberResponse `json:"members"`
+}
+
+type UserFamilyResponse struct {
+	Id       int64  `json:"id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	Selected bool   `json:"selected"`
+}
+
+func familyResponse(family database.Family, members []database.GetUsersByFamilyRow) FamilyResponse {
+	res := FamilyResponse{
+		Id:            family.ID,
+		CreatedAt:     family.CreatedAt.Time.Format(time.DateTime),
+		UpdatedAt:     family.UpdatedAt.Time.Format(time.DateTime),
+		Name:          family.Name,
+		Description:   family.Description,
+		LocationExif:  family.LocationExif,
+		KeepLocations: family.KeepLocations,
+		Members:       []FamilyMemberResponse{},
+	}
+	for _, m := range members {
+		res.Members = append(res.Members, FamilyMemberResponse{
+			Id:        m.ID,
+			Name:      m.Name,
+			CreatedAt: m.CreatedAt.Time.Format(time.DateTime),
+			IsAdmin:   m.IsAdmin,
+		})
+	}
+	return res
+}
+
+func isJSONRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+func readFamilyParams(r *http.Request) (FamilyParams, error) {
+	body := FamilyParams{}
+	if isJSONRequest(r) {
+		err := json.NewDecoder(r.Body).Decode(&body)
+		return body, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return body, err
+	}
+	body.Name = r.FormValue("name")
+	body.Description = r.FormValue("description")
+	// an unticked checkbox isn't sent, the settings form always sends location_exif alongside it
+	if _, ok := r.PostForm["location_exif"]; ok {
+		body.LocationExif = r.PostForm.Get("location_exif")
+		keep := r.PostForm.Get("keep_locations") == "on"
+		body.KeepLocations = &keep
+	}
+	return body, nil
+}
+
+// adminFamily returns the user's selected family, provided they are one of its admins
+func (a *App) adminFamily(ctx context.Context, user database.User) (database.Family, error) {
+	family, err := a.DB.GetUserFamily(ctx, user.ID)
+	if err != nil {
+		return family, err
+	}
+	membership, err := a.DB.GetFamilyMembership(ctx, database.GetFamilyMembershipParams{
+		UserID:   user.ID,
+		FamilyID: family.ID,
+	})
+	if err != nil || membership.Role != roleAdmin {
+		return family, errNotFamilyAdmin
+	}
+	return family, nil
+}
+
+// withSelectedFamily makes sure the family a user is looking at is one they still belong to,
+// falling back to their oldest membership after they have been removed from it
+func (a *App) withSelectedFamily(ctx context.Context, user database.User) (database.User, error) {
+	if !user.FamilyID.Valid {
+		return user, nil
+	}
+	_, err := a.DB.GetFamilyMembership(ctx, database.GetFamilyMembershipParams{
+		UserID:   user.ID,
+		FamilyID: user.FamilyID.Int64,
+	})
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return user, err
+	}
+	err = a.DB.ReselectUserFamily(ctx, database.ReselectUserFamilyParams{
+		ID:       user.ID,
+		FamilyID: user.FamilyID,
+	})
+	if err != nil {
+		return user, err
+	}
+	return a.DB.GetUserByID(ctx, user.ID)
+}
+
+// respondFamilyChanged sends JSON clients the updated family and browsers back to the family page
+func (a *App) respondFamilyChanged(w http.ResponseWriter, r *http.Request, user database.User, status int) {
+	if !isJSONRequest(r) {
+		http.Redirect(w, r, "/family", http.StatusSeeOther)
+		return
+	}
+	family, err := a.DB.GetUserFamily(r.Context(), user.ID)
+	if err != nil {
+		internal.RespondWithError(w, http.StatusNotFound, "no family")
+		return
+	}
+	members, _ := a.DB.GetUsersByFamily(r.Context(), family.ID)
+	internal.RespondWithJSON(w, status, familyResponse(family, members))
+}
+
+// FamiliesList lists every family the user belongs to, marking the one they are looking at
+func (a *App) FamiliesList(w http.ResponseWriter, r *http.Request, user database.User) {
+	families, err := a.DB.GetUserFamilies(r.Context(), user.ID)
+	if err != nil {
+		internal.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	res := []UserFamilyResponse{}
+	for _, f := range families {
+		res = append(res, UserFamilyResponse{
+			Id:       f.ID,
+			Name:     f.Name,
+			Role:     f.Role,
+			Selected: user.FamilyID.Valid && user.FamilyID.Int64 == f.ID,
+		})
+	}
+	internal.RespondWithJSON(w, http.StatusOK, res)
+}
+
+func (a *App) FamilyNew(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	component := htmx.NewComponent("views/family-new.html").SetData(map[string]any{
+		"HasFamily": user.FamilyID.Valid,
+	})
+	page := mainContentWithNavbar("Phamily Photos New Family", a.navbarWithUser(r.Context(), user))
+	page.With(component, "Content")
+
+	_, err := h.Render(r.Context(), page)
+	if err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+// FamilyCreate starts a new family with the user as its admin and switches them to it
+func (a *App) FamilyCreate(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	body, err := readFamilyParams(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, "a family needs a name")
+		return
+	}
+
+	err = a.withTx(r.Context(), func(txq *database.Queries) error {
+		family, err := txq.CreateFamily(r.Context(), database.CreateFamilyParams{
+			Name:        body.Name,
+			Description: body.Description,
+		})
+		if err != nil {
+			return err
+		}
+		err = txq.CreateFamilyMembership(r.Context(), database.CreateFamilyMembershipParams{
+			UserID:   user.ID,
+			FamilyID: family.ID,
+			Role:     roleAdmin,
+		})
+		if err != nil {
+			return err
+		}
+		return txq.SetUserFamily(r.Context(), database.SetUserFamilyParams{
+			ID:       user.ID,
+			FamilyID: pgtype.Int8{Int64: family.ID, Valid: true},
+		})
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.respondFamilyChanged(w, r, user, http.StatusCreated)
+}
+
+// FamilySelect switches the family the user is looking at to another one they belong to
+func (a *App) FamilySelect(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	body := FamilySelectParams{}
+	if isJSONRequest(r) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+			return
+		}
+		id, err := strconv.ParseInt(r.FormValue("family_id"), 10, 64)
+		if err != nil {
+			internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, "invalid family_id")
+			return
+		}
+		body.FamilyId = id
+	}
+	_, err := a.DB.GetFamilyMembership(r.Context(), database.GetFamilyMembershipParams{
+		UserID:   user.ID,
+		FamilyID: body.FamilyId,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, errNotFamilyMember.Error())
+		return
+	}
+	err = a.DB.SetUserFamily(r.Context(), database.SetUserFamilyParams{
+		ID:       user.ID,
+		FamilyID: pgtype.Int8{Int64: body.FamilyId, Valid: true},
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// everything on the page belongs to the previous family, so the navbar switcher reloads it
+	if h.IsHxRequest() {
+		h.Refresh(true)
+		internal.RespondWithOk(w)
+		return
+	}
+	a.respondFamilyChanged(w, r, user, http.StatusOK)
+}
+
+// FamilyUpdate changes the family's name and description
+func (a *App) FamilyUpdate(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	family, err := a.adminFamily(r.Context(), user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusForbidden, errNotFamilyAdmin.Error())
+		return
+	}
+	body, err := readFamilyParams(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, "a family needs a name")
+		return
+	}
+	params := database.UpdateFamilyParams{
+		ID:            family.ID,
+		Name:          body.Name,
+		Description:   body.Description,
+		LocationExif:  family.LocationExif,
+		KeepLocations: family.KeepLocations,
+	}
+	if body.LocationExif != "" {
+		if !internal.LocationPolicy(body.LocationExif).Valid() {
+			internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, "location_exif must be keep, coarsen or strip")
+			return
+		}
+		params.LocationExif = body.LocationExif
+	}
+	if body.KeepLocations != nil {
+		params.KeepLocations = *body.KeepLocations
+	}
+	_, err = a.DB.UpdateFamily(r.Context(), params)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.respondFamilyChanged(w, r, user, http.StatusOK)
+}
+
+// FamilyMemberDelete removes someone from the admin's family, their posts stay with the family
+func (a *App) FamilyMemberDelete(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	family, err := a.adminFamily(r.Context(), user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusForbidden, errNotFamilyAdmin.Error())
+		return
+	}
+	memberID := r.PathValue("userID")
+	if memberID == user.ID {
+		internal.RespondWithErrorHtmx(h, w, http.StatusConflict, errAdminMustStay.Error())
+		return
+	}
+	var removed int64
+	err = a.withTx(r.Context(), func(txq *database.Queries) error {
+		removed, err = txq.DeleteFamilyMembership(r.Context(), database.DeleteFamilyMembershipParams{
+			UserID:   memberID,
+			FamilyID: family.ID,
+		})
+		if err != nil || removed == 0 {
+			return err
+		}
+		// if they were looking at this family, move them to another one they belong to
+		return txq.ReselectUserFamily(r.Context(), database.ReselectUserFamilyParams{
+			ID:       memberID,
+			FamilyID: pgtype.Int8{Int64: family.ID, Valid: true},
+		})
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if removed == 0 {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	internal.RespondWithOk(w)
+}
+
+// FamilyAdminUpdate hands the admin role to another member of the family
+func (a *App) FamilyAdminUpdate(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	family, err := a.adminFamily(r.Context(), user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusForbidden, errNotFamilyAdmin.Error())
+		return
+	}
+	body := FamilyAdminParams{}
+	if isJSONRequest(r) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+			return
+		}
+		body.UserId = r.FormValue("user_id")
+	}
+	err = a.withTx(r.Context(), func(txq *database.Queries) error {
+		promoted, err := txq.SetFamilyMembershipRole(r.Context(), database.SetFamilyMembershipRoleParams{
+			UserID:   body.UserId,
+			FamilyID: family.ID,
+			Role:     roleAdmin,
+		})
+		if err != nil {
+			return err
+		}
+		if promoted == 0 {
+			return errNotFamilyMember
+		}
+		if body.UserId == user.ID {
+			return nil
+		}
+		_, err = txq.SetFamilyMembershipRole(r.Context(), database.SetFamilyMembershipRoleParams{
+			UserID:   user.ID,
+			FamilyID: family.ID,
+			Role:     roleMember,
+		})
+		return err
+	})
+	if errors.Is(err, errNotFamilyMember) {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.respondFamilyChanged(w, r, user, http.StatusOK)
+}
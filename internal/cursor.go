@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("INVALID_CURSOR")
+
+// Cursor marks where a page of posts ended, the next page starts at whatever was created before it.
+// Ties on created_at are broken by id so no post is skipped or repeated.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// String encodes the cursor for a query string, postgres timestamps are microsecond precision so this round trips
+func (c Cursor) String() string {
+	return fmt.Sprintf("%d-%d", c.CreatedAt.UnixMicro(), c.ID)
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	micros, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	us, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n < 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{CreatedAt: time.UnixMicro(us).UTC(), ID: n}, nil
+}
+
+// PairCursor marks where a page of look-alike photos ended. Pairs come closest first, then by the newer
+// first photo, ties are broken by the ids of both photos.
+type PairCursor struct {
+	Distance     int32
+	CreatedAt    time.Time
+	PhotoID      string
+	OtherPhotoID string
+}
+
+// String encodes the cursor for a query string, the photo ids are uuids so they are kept apart with a dot
+func (c PairCursor) String() string {
+	return fmt.Sprintf("%d-%d-%s.%s", c.Distance, c.CreatedAt.UnixMicro(), c.PhotoID, c.OtherPhotoID)
+}
+
+func ParsePairCursor(s string) (PairCursor, error) {
+	parts := strings.SplitN(s, "-", 3)
+	if len(parts) != 3 {
+		return PairCursor{}, ErrInvalidCursor
+	}
+	distance, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil || distance < 0 {
+		return PairCursor{}, ErrInvalidCursor
+	}
+	us, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return PairCursor{}, ErrInvalidCursor
+	}
+	id, other, ok := strings.Cut(parts[2], ".")
+	if !ok || id == "" || other == "" {
+		return PairCursor{}, ErrInvalidCursor
+	}
+	return PairCursor{Distance: int32(distance), CreatedAt: time.UnixMicro(us).UTC(), PhotoID: id, OtherPhotoID: other}, nil
+}
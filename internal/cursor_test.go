@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 11, 20, 8, 30, 15, 123456000, time.UTC)
+	c := Cursor{CreatedAt: created, ID: 42}
+
+	parsed, err := ParseCursor(c.String())
+	assert.NoError(t, err)
+	assert.True(t, created.Equal(parsed.CreatedAt))
+	assert.Equal(t, int64(42), parsed.ID)
+}
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		wantErr bool
+	}{
+		{name: "valid", cursor: "1732091415123456-42"},
+		{name: "empty", cursor: "", wantErr: true},
+		{name: "missing id", cursor: "1732091415123456", wantErr: true},
+		{name: "not a number", cursor: "yesterday-42", wantErr: true},
+		{name: "negative id", cursor: "1732091415123456--1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCursor(tt.cursor)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidCursor)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPairCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 11, 20, 8, 30, 15, 123456000, time.UTC)
+	c := PairCursor{
+		Distance:     3,
+		CreatedAt:    created,
+		PhotoID:      "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0",
+		OtherPhotoID: "f0e9d8c7-b6a5-9483-7261-504f3e2d1c0b",
+	}
+
+	parsed, err := ParsePairCursor(c.String())
+	assert.NoError(t, err)
+	assert.True(t, created.Equal(parsed.CreatedAt))
+	assert.Equal(t, c.Distance, parsed.Distance)
+	assert.Equal(t, c.PhotoID, parsed.PhotoID)
+	assert.Equal(t, c.OtherPhotoID, parsed.OtherPhotoID)
+}
+
+func TestParsePairCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		wantErr bool
+	}{
+		{name: "valid", cursor: "3-1732091415123456-a.b"},
+		{name: "empty", cursor: "", wantErr: true},
+		{name: "missing photos", cursor: "3-1732091415123456", wantErr: true},
+		{name: "one photo", cursor: "3-1732091415123456-a", wantErr: true},
+		{name: "no other photo", cursor: "3-1732091415123456-a.", wantErr: true},
+		{name: "not a number", cursor: "close-1732091415123456-a.b", wantErr: true},
+		{name: "negative distance", cursor: "-3-1732091415123456-a.b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePairCursor(tt.cursor)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidCursor)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -7,32 +7,21 @@ package database
 
 import (
 	"context"
-
-	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createFamily = `-- name: CreateFamily :one
-INSERT INTO families (id, created_at, updated_at, name, description)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, created_at, updated_at, name, description
+INSERT INTO families (created_at, updated_at, name, description)
+VALUES (NOW(), NOW(), $1, $2)
+RETURNING id, created_at, updated_at, name, description, location_exif, keep_locations
 `
 
 type CreateFamilyParams struct {
-	ID          int64
-	CreatedAt   pgtype.Timestamp
-	UpdatedAt   pgtype.Timestamp
 	Name        string
 	Description string
 }
 
 func (q *Queries) CreateFamily(ctx context.Context, arg CreateFamilyParams) (Family, error) {
-	row := q.db.QueryRow(ctx, createFamily,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Name,
-		arg.Description,
-	)
+	row := q.db.QueryRow(ctx, createFamily, arg.Name, arg.Description)
 	var i Family
 	err := row.Scan(
 		&i.ID,
@@ -40,12 +29,14 @@ func (q *Queries) CreateFamily(ctx context.Context, arg CreateFamilyParams) (Fam
 		&i.UpdatedAt,
 		&i.Name,
 		&i.Description,
+		&i.LocationExif,
+		&i.KeepLocations,
 	)
 	return i, err
 }
 
 const getFamilyById = `-- name: GetFamilyById :one
-SELECT id, created_at, updated_at, name, description FROM families
+SELECT id, created_at, updated_at, name, description, location_exif, keep_locations FROM families
 WHERE id = $1
 `
 
@@ -58,12 +49,14 @@ func (q *Queries) GetFamilyById(ctx context.Context, id int64) (Family, error) {
 		&i.UpdatedAt,
 		&i.Name,
 		&i.Description,
+		&i.LocationExif,
+		&i.KeepLocations,
 	)
 	return i, err
 }
 
 const getUserFamily = `-- name: GetUserFamily :one
-SELECT id, created_at, updated_at, name, description FROM families AS f
+SELECT id, created_at, updated_at, name, description, location_exif, keep_locations FROM families AS f
 WHERE id = (
     SELECT family_id
 		FROM users as u
@@ -80,6 +73,44 @@ func (q *Queries) GetUserFamily(ctx context.Context, id string) (Family, error)
 		&i.UpdatedAt,
 		&i.Name,
 		&i.Description,
+		&i.LocationExif,
+		&i.KeepLocations,
+	)
+	return i, err
+}
+
+const updateFamily = `-- name: UpdateFamily :one
+UPDATE families
+SET name = $2, description = $3, location_exif = $4, keep_locations = $5, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, description, location_exif, keep_locations
+`
+
+type UpdateFamilyParams struct {
+	ID            int64
+	Name          string
+	Description   string
+	LocationExif  string
+	KeepLocations bool
+}
+
+func (q *Queries) UpdateFamily(ctx context.Context, arg UpdateFamilyParams) (Family, error) {
+	row := q.db.QueryRow(ctx, updateFamily,
+		arg.ID,
+		arg.Name,
+		arg.Description,
+		arg.LocationExif,
+		arg.KeepLocations,
+	)
+	var i Family
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Description,
+		&i.LocationExif,
+		&i.KeepLocations,
 	)
 	return i, err
 }
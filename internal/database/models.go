@@ -8,25 +8,79 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Comment struct {
+	ID        int64
+	PostID    int64
+	UserID    string
+	Body      string
+	CreatedAt pgtype.Timestamp
+	UpdatedAt pgtype.Timestamp
+}
+
 type Family struct {
-	ID          int64
-	CreatedAt   pgtype.Timestamp
-	UpdatedAt   pgtype.Timestamp
-	Name        string
-	Description string
+	ID            int64
+	CreatedAt     pgtype.Timestamp
+	UpdatedAt     pgtype.Timestamp
+	Name          string
+	Description   string
+	LocationExif  string
+	KeepLocations bool
+}
+
+type FamilyInvite struct {
+	ID        int64
+	TokenHash string
+	FamilyID  int64
+	CreatedBy string
+	CreatedAt pgtype.Timestamp
+	ExpiresAt pgtype.Timestamp
+	UsedAt    pgtype.Timestamp
+	UsedBy    pgtype.Text
+}
+
+type FamilyMembership struct {
+	UserID    string
+	FamilyID  int64
+	Role      string
+	CreatedAt pgtype.Timestamp
 }
 
 type Photo struct {
-	ID         string
-	CreatedAt  pgtype.Timestamp
-	UpdatedAt  pgtype.Timestamp
-	ModifiedAt pgtype.Timestamp
-	Name       string
-	AltText    string
-	Url        string
-	ThumbUrl   string
-	UserID     string
-	PostID     pgtype.Int8
+	ID             string
+	CreatedAt      pgtype.Timestamp
+	UpdatedAt      pgtype.Timestamp
+	ModifiedAt     pgtype.Timestamp
+	Name           string
+	AltText        string
+	Url            string
+	ThumbUrl       string
+	UserID         string
+	PostID         pgtype.Int8
+	MediumUrl      string
+	ContentHash    pgtype.Text
+	PerceptualHash pgtype.Int8
+	MediaType      string
+	Width          pgtype.Int4
+	Height         pgtype.Int4
+	DurationMs     pgtype.Int4
+	Size           pgtype.Int8
+	DeletedAt      pgtype.Timestamp
+	SortOrder      pgtype.Int4
+}
+
+type PhotoMetadata struct {
+	PhotoID      string
+	TakenAt      pgtype.Timestamp
+	CameraMake   string
+	CameraModel  string
+	LensModel    string
+	ExposureTime string
+	FNumber      pgtype.Float8
+	Iso          pgtype.Int4
+	FocalLength  pgtype.Float8
+	Latitude     pgtype.Float8
+	Longitude    pgtype.Float8
+	Orientation  pgtype.Int4
 }
 
 type Post struct {
@@ -37,14 +91,40 @@ type Post struct {
 	FeaturedPhotoID pgtype.Text
 	UserID          string
 	FamilyID        int64
+	UploadBatch     pgtype.Text
+	DeletedAt       pgtype.Timestamp
 }
 
-type User struct {
-	ID        string
+type Reaction struct {
+	ID        int64
+	PostID    pgtype.Int8
+	PhotoID   pgtype.Text
+	UserID    string
+	Emoji     string
 	CreatedAt pgtype.Timestamp
-	UpdatedAt pgtype.Timestamp
-	Name      string
-	Apikey    string
-	FamilyID  pgtype.Int8
-	Password  string
+}
+
+type Upload struct {
+	ID           string
+	UserID       string
+	FamilyID     int64
+	Length       int64
+	Batch        string
+	Caption      string
+	Filename     string
+	CreatedAt    pgtype.Timestamp
+	ExpiresAt    pgtype.Timestamp
+	CompletedAt  pgtype.Timestamp
+	UploadOffset int64
+	Chunks       []string
+}
+
+type User struct {
+	ID         string
+	CreatedAt  pgtype.Timestamp
+	UpdatedAt  pgtype.Timestamp
+	Name       string
+	ApikeyHash pgtype.Text
+	FamilyID   pgtype.Int8
+	Password   string
 }
@@ -11,35 +11,86 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const copyPhotoMetadata = `-- name: CopyPhotoMetadata :exec
+INSERT INTO photo_metadata (photo_id, taken_at, camera_make, camera_model, lens_model, exposure_time,
+    f_number, iso, focal_length, latitude, longitude, orientation)
+SELECT $1, taken_at, camera_make, camera_model, lens_model, exposure_time,
+    f_number, iso, focal_length, latitude, longitude, orientation
+FROM photo_metadata
+WHERE photo_id = $2
+ON CONFLICT (photo_id) DO NOTHING
+`
+
+type CopyPhotoMetadataParams struct {
+	IntoID  string
+	PhotoID string
+}
+
+// gives a photo the camera details of another when it has none of its own, the other keeps its copy
+func (q *Queries) CopyPhotoMetadata(ctx context.Context, arg CopyPhotoMetadataParams) error {
+	_, err := q.db.Exec(ctx, copyPhotoMetadata, arg.IntoID, arg.PhotoID)
+	return err
+}
+
+const countPhotosByUrl = `-- name: CountPhotosByUrl :one
+SELECT COUNT(*) FROM photos
+WHERE url = $1
+`
+
+func (q *Queries) CountPhotosByUrl(ctx context.Context, url string) (int64, error) {
+	row := q.db.QueryRow(ctx, countPhotosByUrl, url)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createPhoto = `-- name: CreatePhoto :one
-INSERT INTO photos (id, created_at, updated_at, modified_at, name, alt_text, url, thumb_url, user_id, post_id)
-VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, modified_at, name, alt_text, url, thumb_url, user_id, post_id, TRUE AS is_my_photo
+INSERT INTO photos (id, modified_at, name, alt_text, url, thumb_url, medium_url, user_id, post_id, content_hash, perceptual_hash, media_type, width, height, duration_ms, size)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+RETURNING id, created_at, updated_at, modified_at, name, alt_text, url, thumb_url, user_id, post_id, medium_url, content_hash, perceptual_hash, media_type, width, height, duration_ms, size, deleted_at, sort_order, TRUE AS is_my_photo
 `
 
 type CreatePhotoParams struct {
-	ID         string
-	ModifiedAt pgtype.Timestamp
-	Name       string
-	AltText    string
-	Url        string
-	ThumbUrl   string
-	UserID     string
-	PostID     pgtype.Int8
+	ID             string
+	ModifiedAt     pgtype.Timestamp
+	Name           string
+	AltText        string
+	Url            string
+	ThumbUrl       string
+	MediumUrl      string
+	UserID         string
+	PostID         pgtype.Int8
+	ContentHash    pgtype.Text
+	PerceptualHash pgtype.Int8
+	MediaType      string
+	Width          pgtype.Int4
+	Height         pgtype.Int4
+	DurationMs     pgtype.Int4
+	Size           pgtype.Int8
 }
 
 type CreatePhotoRow struct {
-	ID         string
-	CreatedAt  pgtype.Timestamp
-	UpdatedAt  pgtype.Timestamp
-	ModifiedAt pgtype.Timestamp
-	Name       string
-	AltText    string
-	Url        string
-	ThumbUrl   string
-	UserID     string
-	PostID     pgtype.Int8
-	IsMyPhoto  bool
+	ID             string
+	CreatedAt      pgtype.Timestamp
+	UpdatedAt      pgtype.Timestamp
+	ModifiedAt     pgtype.Timestamp
+	Name           string
+	AltText        string
+	Url            string
+	ThumbUrl       string
+	UserID         string
+	PostID         pgtype.Int8
+	MediumUrl      string
+	ContentHash    pgtype.Text
+	PerceptualHash pgtype.Int8
+	MediaType      string
+	Width          pgtype.Int4
+	Height         pgtype.Int4
+	DurationMs     pgtype.Int4
+	Size           pgtype.Int8
+	DeletedAt      pgtype.Timestamp
+	SortOrder      pgtype.Int4
+	IsMyPhoto      bool
 }
 
 func (q *Queries) CreatePhoto(ctx context.Context, arg CreatePhotoParams) (CreatePhotoRow, error) {
@@ -50,8 +101,16 @@ func (q *Queries) CreatePhoto(ctx context.Context, arg CreatePhotoParams) (Creat
 		arg.AltText,
 		arg.Url,
 		arg.ThumbUrl,
+		arg.MediumUrl,
 		arg.UserID,
 		arg.PostID,
+		arg.ContentHash,
+		arg.PerceptualHash,
+		arg.MediaType,
+		arg.Width,
+		arg.Height,
+		arg.DurationMs,
+		arg.Size,
 	)
 	var i CreatePhotoRow
 	err := row.Scan(
@@ -65,31 +124,307 @@ func (q *Queries) CreatePhoto(ctx context.Context, arg CreatePhotoParams) (Creat
 		&i.ThumbUrl,
 		&i.UserID,
 		&i.PostID,
+		&i.MediumUrl,
+		&i.ContentHash,
+		&i.PerceptualHash,
+		&i.MediaType,
+		&i.Width,
+		&i.Height,
+		&i.DurationMs,
+		&i.Size,
+		&i.DeletedAt,
+		&i.SortOrder,
 		&i.IsMyPhoto,
 	)
 	return i, err
 }
 
-const deletePhoto = `-- name: DeletePhoto :exec
-DELETE FROM photos
-    WHERE id=$1 AND user_id=$2
+const createPhotoMetadata = `-- name: CreatePhotoMetadata :exec
+INSERT INTO photo_metadata (
+    photo_id, taken_at, camera_make, camera_model, lens_model, exposure_time,
+    f_number, iso, focal_length, latitude, longitude, orientation
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 `
 
-type DeletePhotoParams struct {
-	ID     string
-	UserID string
+type CreatePhotoMetadataParams struct {
+	PhotoID      string
+	TakenAt      pgtype.Timestamp
+	CameraMake   string
+	CameraModel  string
+	LensModel    string
+	ExposureTime string
+	FNumber      pgtype.Float8
+	Iso          pgtype.Int4
+	FocalLength  pgtype.Float8
+	Latitude     pgtype.Float8
+	Longitude    pgtype.Float8
+	Orientation  pgtype.Int4
 }
 
-func (q *Queries) DeletePhoto(ctx context.Context, arg DeletePhotoParams) error {
-	_, err := q.db.Exec(ctx, deletePhoto, arg.ID, arg.UserID)
+func (q *Queries) CreatePhotoMetadata(ctx context.Context, arg CreatePhotoMetadataParams) error {
+	_, err := q.db.Exec(ctx, createPhotoMetadata,
+		arg.PhotoID,
+		arg.TakenAt,
+		arg.CameraMake,
+		arg.CameraModel,
+		arg.LensModel,
+		arg.ExposureTime,
+		arg.FNumber,
+		arg.Iso,
+		arg.FocalLength,
+		arg.Latitude,
+		arg.Longitude,
+		arg.Orientation,
+	)
 	return err
 }
 
+const getFamilyMedia = `-- name: GetFamilyMedia :one
+SELECT ph.id, ph.created_at, ph.updated_at, ph.modified_at, ph.name, ph.alt_text, ph.url, ph.thumb_url, ph.user_id, ph.post_id, ph.medium_url, ph.content_hash, ph.perceptual_hash, ph.media_type, ph.width, ph.height, ph.duration_ms, ph.size, ph.deleted_at, ph.sort_order FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+    WHERE ph.id=$1 AND p.family_id=$2
+        AND ((ph.deleted_at IS NULL AND p.deleted_at IS NULL) OR ph.user_id=$3)
+`
+
+type GetFamilyMediaParams struct {
+	ID       string
+	FamilyID int64
+	UserID   string
+}
+
+// trashed photos can only be seen by their owner, in the trash
+func (q *Queries) GetFamilyMedia(ctx context.Context, arg GetFamilyMediaParams) (Photo, error) {
+	row := q.db.QueryRow(ctx, getFamilyMedia, arg.ID, arg.FamilyID, arg.UserID)
+	var i Photo
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ModifiedAt,
+		&i.Name,
+		&i.AltText,
+		&i.Url,
+		&i.ThumbUrl,
+		&i.UserID,
+		&i.PostID,
+		&i.MediumUrl,
+		&i.ContentHash,
+		&i.PerceptualHash,
+		&i.MediaType,
+		&i.Width,
+		&i.Height,
+		&i.DurationMs,
+		&i.Size,
+		&i.DeletedAt,
+		&i.SortOrder,
+	)
+	return i, err
+}
+
+const getFamilyNearDuplicates = `-- name: GetFamilyNearDuplicates :many
+SELECT
+    a.id AS photo_id,
+    a.user_id = $1 AS is_my_photo,
+    ua.name AS user_name,
+    a.created_at,
+    b.id AS other_photo_id,
+    b.user_id = $1 AS is_my_other_photo,
+    ub.name AS other_user_name,
+    b.created_at AS other_created_at,
+    bit_count((a.perceptual_hash # b.perceptual_hash)::bit(64))::int AS distance
+FROM photos AS a
+    JOIN posts AS pa ON a.post_id = pa.id
+    JOIN users AS ua ON a.user_id = ua.id
+    JOIN photos AS b ON a.id < b.id
+    JOIN posts AS pb ON b.post_id = pb.id
+    JOIN users AS ub ON b.user_id = ub.id
+WHERE pa.family_id = $2 AND pb.family_id = $2
+    AND a.deleted_at IS NULL AND b.deleted_at IS NULL AND pa.deleted_at IS NULL AND pb.deleted_at IS NULL
+    AND bit_count((a.perceptual_hash # b.perceptual_hash)::bit(64)) <= $3::int
+    AND ($5::int IS NULL
+        OR (-bit_count((a.perceptual_hash # b.perceptual_hash)::bit(64))::int, a.created_at, a.id, b.id)
+            < (-$5::int, $6::timestamp, $7::text, $8::text))
+ORDER BY distance ASC, a.created_at DESC, a.id DESC, b.id DESC
+LIMIT $4
+`
+
+type GetFamilyNearDuplicatesParams struct {
+	UserID            string
+	FamilyID          int64
+	MaxDistance       int32
+	Limit             int32
+	AfterDistance     pgtype.Int4
+	AfterCreatedAt    pgtype.Timestamp
+	AfterPhotoID      pgtype.Text
+	AfterOtherPhotoID pgtype.Text
+}
+
+type GetFamilyNearDuplicatesRow struct {
+	PhotoID        string
+	IsMyPhoto      bool
+	UserName       string
+	CreatedAt      pgtype.Timestamp
+	OtherPhotoID   string
+	IsMyOtherPhoto bool
+	OtherUserName  string
+	OtherCreatedAt pgtype.Timestamp
+	Distance       int32
+}
+
+func (q *Queries) GetFamilyNearDuplicates(ctx context.Context, arg GetFamilyNearDuplicatesParams) ([]GetFamilyNearDuplicatesRow, error) {
+	rows, err := q.db.Query(ctx, getFamilyNearDuplicates,
+		arg.UserID,
+		arg.FamilyID,
+		arg.MaxDistance,
+		arg.Limit,
+		arg.AfterDistance,
+		arg.AfterCreatedAt,
+		arg.AfterPhotoID,
+		arg.AfterOtherPhotoID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFamilyNearDuplicatesRow
+	for rows.Next() {
+		var i GetFamilyNearDuplicatesRow
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.IsMyPhoto,
+			&i.UserName,
+			&i.CreatedAt,
+			&i.OtherPhotoID,
+			&i.IsMyOtherPhoto,
+			&i.OtherUserName,
+			&i.OtherCreatedAt,
+			&i.Distance,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFamilyPhoto = `-- name: GetFamilyPhoto :one
+SELECT ph.id, ph.created_at, ph.updated_at, ph.modified_at, ph.name, ph.alt_text, ph.url, ph.thumb_url, ph.user_id, ph.post_id, ph.medium_url, ph.content_hash, ph.perceptual_hash, ph.media_type, ph.width, ph.height, ph.duration_ms, ph.size, ph.deleted_at, ph.sort_order FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+    WHERE ph.id=$1 AND p.family_id=$2 AND ph.deleted_at IS NULL AND p.deleted_at IS NULL
+`
+
+type GetFamilyPhotoParams struct {
+	ID       string
+	FamilyID int64
+}
+
+func (q *Queries) GetFamilyPhoto(ctx context.Context, arg GetFamilyPhotoParams) (Photo, error) {
+	row := q.db.QueryRow(ctx, getFamilyPhoto, arg.ID, arg.FamilyID)
+	var i Photo
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ModifiedAt,
+		&i.Name,
+		&i.AltText,
+		&i.Url,
+		&i.ThumbUrl,
+		&i.UserID,
+		&i.PostID,
+		&i.MediumUrl,
+		&i.ContentHash,
+		&i.PerceptualHash,
+		&i.MediaType,
+		&i.Width,
+		&i.Height,
+		&i.DurationMs,
+		&i.Size,
+		&i.DeletedAt,
+		&i.SortOrder,
+	)
+	return i, err
+}
+
+const getFamilyPhotoByHash = `-- name: GetFamilyPhotoByHash :one
+SELECT ph.id, ph.created_at, ph.updated_at, ph.modified_at, ph.name, ph.alt_text, ph.url, ph.thumb_url, ph.user_id, ph.post_id, ph.medium_url, ph.content_hash, ph.perceptual_hash, ph.media_type, ph.width, ph.height, ph.duration_ms, ph.size, ph.deleted_at, ph.sort_order FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+    WHERE ph.content_hash=$1 AND p.family_id=$2 AND ph.deleted_at IS NULL AND p.deleted_at IS NULL
+    ORDER BY ph.created_at ASC
+    LIMIT 1
+`
+
+type GetFamilyPhotoByHashParams struct {
+	ContentHash pgtype.Text
+	FamilyID    int64
+}
+
+func (q *Queries) GetFamilyPhotoByHash(ctx context.Context, arg GetFamilyPhotoByHashParams) (Photo, error) {
+	row := q.db.QueryRow(ctx, getFamilyPhotoByHash, arg.ContentHash, arg.FamilyID)
+	var i Photo
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ModifiedAt,
+		&i.Name,
+		&i.AltText,
+		&i.Url,
+		&i.ThumbUrl,
+		&i.UserID,
+		&i.PostID,
+		&i.MediumUrl,
+		&i.ContentHash,
+		&i.PerceptualHash,
+		&i.MediaType,
+		&i.Width,
+		&i.Height,
+		&i.DurationMs,
+		&i.Size,
+		&i.DeletedAt,
+		&i.SortOrder,
+	)
+	return i, err
+}
+
+const getFamilyStorageUsed = `-- name: GetFamilyStorageUsed :one
+SELECT COALESCE(SUM(stored.size), 0)::bigint AS used FROM (
+    SELECT DISTINCT ON (ph.url) ph.size FROM photos AS ph
+        JOIN posts AS p ON ph.post_id = p.id
+        WHERE p.family_id = $1
+) AS stored
+`
+
+// photos sharing the files of a duplicate upload only count once
+func (q *Queries) GetFamilyStorageUsed(ctx context.Context, familyID int64) (int64, error) {
+	row := q.db.QueryRow(ctx, getFamilyStorageUsed, familyID)
+	var used int64
+	err := row.Scan(&used)
+	return used, err
+}
+
 const getPhoto = `-- name: GetPhoto :one
-SELECT p.id, p.created_at, p.updated_at, modified_at, p.name, alt_text, url, thumb_url, user_id, post_id, u.id, u.created_at, u.updated_at, u.name, apikey, family_id, password, p.user_id = $2 AS is_my_photo, u.name AS user_name 
+SELECT p.id, p.created_at, p.updated_at, p.modified_at, p.name, p.alt_text, p.url, p.thumb_url, p.user_id, p.post_id, p.medium_url, p.content_hash, p.perceptual_hash, p.media_type, p.width, p.height, p.duration_ms, p.size, p.deleted_at, p.sort_order, p.user_id = $2 AS is_my_photo, u.name AS user_name,
+    (SELECT json_agg(json_build_object('emoji', r.emoji, 'count', r.count, 'users', r.users, 'mine', r.mine) ORDER BY r.first_at)
+        FROM (
+            SELECT re.emoji, COUNT(*) AS count, json_agg(ru.name ORDER BY re.created_at) AS users,
+                bool_or(re.user_id = $2) AS mine, MIN(re.created_at) AS first_at
+            FROM reactions AS re
+                JOIN users AS ru ON re.user_id = ru.id
+            WHERE re.photo_id = p.id
+            GROUP BY re.emoji
+        ) AS r) AS reactions
     FROM photos AS p
     JOIN users AS u ON p.user_id = u.id
-    WHERE p.id=$1 AND user_id=$2
+    WHERE p.id=$1 AND p.deleted_at IS NULL AND p.post_id IN (
+        SELECT po.id FROM posts AS po
+            JOIN users AS me ON po.family_id = me.family_id
+            WHERE me.id=$2 AND po.deleted_at IS NULL
+    )
 `
 
 type GetPhotoParams struct {
@@ -98,25 +433,29 @@ type GetPhotoParams struct {
 }
 
 type GetPhotoRow struct {
-	ID          string
-	CreatedAt   pgtype.Timestamp
-	UpdatedAt   pgtype.Timestamp
-	ModifiedAt  pgtype.Timestamp
-	Name        string
-	AltText     string
-	Url         string
-	ThumbUrl    string
-	UserID      string
-	PostID      pgtype.Int8
-	ID_2        string
-	CreatedAt_2 pgtype.Timestamp
-	UpdatedAt_2 pgtype.Timestamp
-	Name_2      string
-	Apikey      string
-	FamilyID    pgtype.Int8
-	Password    string
-	IsMyPhoto   bool
-	UserName    string
+	ID             string
+	CreatedAt      pgtype.Timestamp
+	UpdatedAt      pgtype.Timestamp
+	ModifiedAt     pgtype.Timestamp
+	Name           string
+	AltText        string
+	Url            string
+	ThumbUrl       string
+	UserID         string
+	PostID         pgtype.Int8
+	MediumUrl      string
+	ContentHash    pgtype.Text
+	PerceptualHash pgtype.Int8
+	MediaType      string
+	Width          pgtype.Int4
+	Height         pgtype.Int4
+	DurationMs     pgtype.Int4
+	Size           pgtype.Int8
+	DeletedAt      pgtype.Timestamp
+	SortOrder      pgtype.Int4
+	IsMyPhoto      bool
+	UserName       string
+	Reactions      interface{}
 }
 
 func (q *Queries) GetPhoto(ctx context.Context, arg GetPhotoParams) (GetPhotoRow, error) {
@@ -133,79 +472,145 @@ func (q *Queries) GetPhoto(ctx context.Context, arg GetPhotoParams) (GetPhotoRow
 		&i.ThumbUrl,
 		&i.UserID,
 		&i.PostID,
-		&i.ID_2,
-		&i.CreatedAt_2,
-		&i.UpdatedAt_2,
-		&i.Name_2,
-		&i.Apikey,
-		&i.FamilyID,
-		&i.Password,
+		&i.MediumUrl,
+		&i.ContentHash,
+		&i.PerceptualHash,
+		&i.MediaType,
+		&i.Width,
+		&i.Height,
+		&i.DurationMs,
+		&i.Size,
+		&i.DeletedAt,
+		&i.SortOrder,
 		&i.IsMyPhoto,
 		&i.UserName,
+		&i.Reactions,
+	)
+	return i, err
+}
+
+const getPhotoMetadata = `-- name: GetPhotoMetadata :one
+SELECT photo_id, taken_at, camera_make, camera_model, lens_model, exposure_time, f_number, iso, focal_length, latitude, longitude, orientation FROM photo_metadata
+WHERE photo_id = $1
+`
+
+func (q *Queries) GetPhotoMetadata(ctx context.Context, photoID string) (PhotoMetadata, error) {
+	row := q.db.QueryRow(ctx, getPhotoMetadata, photoID)
+	var i PhotoMetadata
+	err := row.Scan(
+		&i.PhotoID,
+		&i.TakenAt,
+		&i.CameraMake,
+		&i.CameraModel,
+		&i.LensModel,
+		&i.ExposureTime,
+		&i.FNumber,
+		&i.Iso,
+		&i.FocalLength,
+		&i.Latitude,
+		&i.Longitude,
+		&i.Orientation,
 	)
 	return i, err
 }
 
-const getPhotosByUser = `-- name: GetPhotosByUser :many
-SELECT p.id, p.created_at, p.updated_at, modified_at, p.name, alt_text, url, thumb_url, user_id, post_id, u.id, u.created_at, u.updated_at, u.name, apikey, family_id, password FROM photos AS p 
-    JOIN users AS u ON p.user_id = u.id 
-    WHERE u.id=$1
-    ORDER BY p.modified_at DESC
-    LIMIT $2
+const getPostsByUserFamilyAggregated = `-- name: GetPostsByUserFamilyAggregated :many
+SELECT
+    p.id AS post_id,
+    p.created_at AS post_created_at,
+    p.updated_at AS post_updated_at,
+    p.description AS post_description,
+    p.featured_photo_id AS post_featured_photo_id,
+    p.user_id = $3 AS is_my_post,
+    u.name AS user_name,
+    f.name AS family_name,
+    (SELECT COUNT(*) FROM comments AS c WHERE c.post_id = p.id) AS comment_count,
+    (SELECT json_agg(json_build_object('emoji', r.emoji, 'count', r.count, 'users', r.users, 'mine', r.mine) ORDER BY r.first_at)
+        FROM (
+            SELECT re.emoji, COUNT(*) AS count, json_agg(ru.name ORDER BY re.created_at) AS users,
+                bool_or(re.user_id = $3) AS mine, MIN(re.created_at) AS first_at
+            FROM reactions AS re
+                JOIN users AS ru ON re.user_id = ru.id
+            WHERE re.post_id = p.id
+            GROUP BY re.emoji
+        ) AS r) AS reactions,
+    json_arrayagg(json_build_object(
+        'photo_id', ph.id,
+        'photo_name', ph.name,
+        'photo_url', ph.url,
+        'photo_thumb_url', ph.thumb_url,
+        'photo_medium_url', ph.medium_url,
+        'media_type', ph.media_type,
+        'has_preview', ph.thumb_url <> ph.url
+    ) ORDER BY ph.id = p.featured_photo_id DESC, ph.sort_order ASC NULLS LAST, ph.modified_at ASC) AS photos
+FROM 
+    posts p
+JOIN 
+    users u ON p.user_id = u.id
+JOIN 
+    families f ON p.family_id = f.id
+JOIN 
+    photos ph ON ph.post_id = p.id AND ph.deleted_at IS NULL
+WHERE 
+    p.family_id = $1 AND p.deleted_at IS NULL
+    AND ($4::timestamp IS NULL
+        OR (p.created_at, p.id) < ($4::timestamp, $5::bigint))
+GROUP BY 
+    p.id, u.name, f.name
+ORDER BY 
+    p.created_at DESC, p.id DESC
+LIMIT $2
 `
 
-type GetPhotosByUserParams struct {
-	ID    string
-	Limit int32
-}
-
-type GetPhotosByUserRow struct {
-	ID          string
-	CreatedAt   pgtype.Timestamp
-	UpdatedAt   pgtype.Timestamp
-	ModifiedAt  pgtype.Timestamp
-	Name        string
-	AltText     string
-	Url         string
-	ThumbUrl    string
-	UserID      string
-	PostID      pgtype.Int8
-	ID_2        string
-	CreatedAt_2 pgtype.Timestamp
-	UpdatedAt_2 pgtype.Timestamp
-	Name_2      string
-	Apikey      string
-	FamilyID    pgtype.Int8
-	Password    string
-}
-
-func (q *Queries) GetPhotosByUser(ctx context.Context, arg GetPhotosByUserParams) ([]GetPhotosByUserRow, error) {
-	rows, err := q.db.Query(ctx, getPhotosByUser, arg.ID, arg.Limit)
+type GetPostsByUserFamilyAggregatedParams struct {
+	FamilyID        int64
+	Limit           int32
+	UserID          string
+	BeforeCreatedAt pgtype.Timestamp
+	BeforeID        pgtype.Int8
+}
+
+type GetPostsByUserFamilyAggregatedRow struct {
+	PostID              int64
+	PostCreatedAt       pgtype.Timestamp
+	PostUpdatedAt       pgtype.Timestamp
+	PostDescription     string
+	PostFeaturedPhotoID pgtype.Text
+	IsMyPost            bool
+	UserName            string
+	FamilyName          string
+	CommentCount        int64
+	Reactions           interface{}
+	Photos              interface{}
+}
+
+func (q *Queries) GetPostsByUserFamilyAggregated(ctx context.Context, arg GetPostsByUserFamilyAggregatedParams) ([]GetPostsByUserFamilyAggregatedRow, error) {
+	rows, err := q.db.Query(ctx, getPostsByUserFamilyAggregated,
+		arg.FamilyID,
+		arg.Limit,
+		arg.UserID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPhotosByUserRow
+	var items []GetPostsByUserFamilyAggregatedRow
 	for rows.Next() {
-		var i GetPhotosByUserRow
+		var i GetPostsByUserFamilyAggregatedRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.ModifiedAt,
-			&i.Name,
-			&i.AltText,
-			&i.Url,
-			&i.ThumbUrl,
-			&i.UserID,
 			&i.PostID,
-			&i.ID_2,
-			&i.CreatedAt_2,
-			&i.UpdatedAt_2,
-			&i.Name_2,
-			&i.Apikey,
-			&i.FamilyID,
-			&i.Password,
+			&i.PostCreatedAt,
+			&i.PostUpdatedAt,
+			&i.PostDescription,
+			&i.PostFeaturedPhotoID,
+			&i.IsMyPost,
+			&i.UserName,
+			&i.FamilyName,
+			&i.CommentCount,
+			&i.Reactions,
+			&i.Photos,
 		); err != nil {
 			return nil, err
 		}
@@ -217,61 +622,43 @@ func (q *Queries) GetPhotosByUser(ctx context.Context, arg GetPhotosByUserParams
 	return items, nil
 }
 
-const getPhotosByUserFamily = `-- name: GetPhotosByUserFamily :many
-SELECT p.id, p.created_at, p.updated_at, p.modified_at, p.name, p.alt_text, p.url, p.thumb_url, p.user_id, p.post_id, u.name as user_name, p.user_id = $1 AS is_my_photo
-FROM public.photos AS p
-	JOIN users AS u ON p.user_id = u.id
-	WHERE u.family_id = (
-		SELECT family_id
-            FROM users as u
-            WHERE u.id=$1
-	)
-ORDER BY p.modified_at DESC
-LIMIT $2
+const getTrashedPhotos = `-- name: GetTrashedPhotos :many
+SELECT ph.id, ph.media_type, ph.thumb_url <> ph.url AS has_preview, ph.deleted_at, p.description AS post_description
+FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+WHERE ph.user_id = $1 AND p.family_id = $2 AND ph.deleted_at IS NOT NULL AND p.deleted_at IS NULL
+ORDER BY ph.deleted_at DESC
 `
 
-type GetPhotosByUserFamilyParams struct {
-	UserID string
-	Limit  int32
+type GetTrashedPhotosParams struct {
+	UserID   string
+	FamilyID int64
 }
 
-type GetPhotosByUserFamilyRow struct {
-	ID         string
-	CreatedAt  pgtype.Timestamp
-	UpdatedAt  pgtype.Timestamp
-	ModifiedAt pgtype.Timestamp
-	Name       string
-	AltText    string
-	Url        string
-	ThumbUrl   string
-	UserID     string
-	PostID     pgtype.Int8
-	UserName   string
-	IsMyPhoto  bool
+type GetTrashedPhotosRow struct {
+	ID              string
+	MediaType       string
+	HasPreview      bool
+	DeletedAt       pgtype.Timestamp
+	PostDescription string
 }
 
-func (q *Queries) GetPhotosByUserFamily(ctx context.Context, arg GetPhotosByUserFamilyParams) ([]GetPhotosByUserFamilyRow, error) {
-	rows, err := q.db.Query(ctx, getPhotosByUserFamily, arg.UserID, arg.Limit)
+// photos of a trashed post are restored with it, so they are left out
+func (q *Queries) GetTrashedPhotos(ctx context.Context, arg GetTrashedPhotosParams) ([]GetTrashedPhotosRow, error) {
+	rows, err := q.db.Query(ctx, getTrashedPhotos, arg.UserID, arg.FamilyID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPhotosByUserFamilyRow
+	var items []GetTrashedPhotosRow
 	for rows.Next() {
-		var i GetPhotosByUserFamilyRow
+		var i GetTrashedPhotosRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.ModifiedAt,
-			&i.Name,
-			&i.AltText,
-			&i.Url,
-			&i.ThumbUrl,
-			&i.UserID,
-			&i.PostID,
-			&i.UserName,
-			&i.IsMyPhoto,
+			&i.MediaType,
+			&i.HasPreview,
+			&i.DeletedAt,
+			&i.PostDescription,
 		); err != nil {
 			return nil, err
 		}
@@ -283,71 +670,49 @@ func (q *Queries) GetPhotosByUserFamily(ctx context.Context, arg GetPhotosByUser
 	return items, nil
 }
 
-const getPostsByUserFamily = `-- name: GetPostsByUserFamily :many
-SELECT 
-    p.id AS post_id,
-    p.created_at AS post_created_at,
-    p.updated_at AS post_updated_at,
-    p.description AS post_description,
-    u.name AS user_name,
-    f.name AS family_name,
-    ph.id AS photo_id,
-    ph.name AS photo_name,
-    ph.url AS photo_url,
-    ph.thumb_url AS photo_thumb_url
-FROM 
-    posts p
-JOIN 
-    users u ON p.user_id = u.id
-JOIN 
-    families f ON p.family_id = f.id
-LEFT JOIN 
-    photos ph ON ph.post_id = p.id
-WHERE
-    p.family_id = $1
-ORDER BY
-    p.created_at DESC
-LIMIT $2
+const getUserPhotosOutsidePost = `-- name: GetUserPhotosOutsidePost :many
+SELECT ph.id, ph.name, ph.media_type, ph.thumb_url <> ph.url AS has_preview
+FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+WHERE ph.user_id = $1 AND p.family_id = $2 AND ph.post_id <> $3
+    AND ph.deleted_at IS NULL AND p.deleted_at IS NULL
+ORDER BY ph.created_at DESC
+LIMIT $4
 `
 
-type GetPostsByUserFamilyParams struct {
+type GetUserPhotosOutsidePostParams struct {
+	UserID   string
 	FamilyID int64
+	PostID   pgtype.Int8
 	Limit    int32
 }
 
-type GetPostsByUserFamilyRow struct {
-	PostID          int64
-	PostCreatedAt   pgtype.Timestamp
-	PostUpdatedAt   pgtype.Timestamp
-	PostDescription string
-	UserName        string
-	FamilyName      string
-	PhotoID         pgtype.Text
-	PhotoName       pgtype.Text
-	PhotoUrl        pgtype.Text
-	PhotoThumbUrl   pgtype.Text
+type GetUserPhotosOutsidePostRow struct {
+	ID         string
+	Name       string
+	MediaType  string
+	HasPreview bool
 }
 
-func (q *Queries) GetPostsByUserFamily(ctx context.Context, arg GetPostsByUserFamilyParams) ([]GetPostsByUserFamilyRow, error) {
-	rows, err := q.db.Query(ctx, getPostsByUserFamily, arg.FamilyID, arg.Limit)
+func (q *Queries) GetUserPhotosOutsidePost(ctx context.Context, arg GetUserPhotosOutsidePostParams) ([]GetUserPhotosOutsidePostRow, error) {
+	rows, err := q.db.Query(ctx, getUserPhotosOutsidePost,
+		arg.UserID,
+		arg.FamilyID,
+		arg.PostID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPostsByUserFamilyRow
+	var items []GetUserPhotosOutsidePostRow
 	for rows.Next() {
-		var i GetPostsByUserFamilyRow
+		var i GetUserPhotosOutsidePostRow
 		if err := rows.Scan(
-			&i.PostID,
-			&i.PostCreatedAt,
-			&i.PostUpdatedAt,
-			&i.PostDescription,
-			&i.UserName,
-			&i.FamilyName,
-			&i.PhotoID,
-			&i.PhotoName,
-			&i.PhotoUrl,
-			&i.PhotoThumbUrl,
+			&i.ID,
+			&i.Name,
+			&i.MediaType,
+			&i.HasPreview,
 		); err != nil {
 			return nil, err
 		}
@@ -359,69 +724,33 @@ func (q *Queries) GetPostsByUserFamily(ctx context.Context, arg GetPostsByUserFa
 	return items, nil
 }
 
-const getPostsByUserFamilyAggregated = `-- name: GetPostsByUserFamilyAggregated :many
-SELECT
-    p.id AS post_id,
-    p.created_at AS post_created_at,
-    p.updated_at AS post_updated_at,
-    p.description AS post_description,
-    u.name AS user_name,
-    f.name AS family_name,
-    json_arrayagg(json_build_object(
-        'photo_id', ph.id,
-        'photo_name', ph.name,
-        'photo_url', ph.url,
-        'photo_thumb_url', ph.thumb_url
-    )) AS photos
-FROM 
-    posts p
-JOIN 
-    users u ON p.user_id = u.id
-JOIN 
-    families f ON u.family_id = f.id
-LEFT JOIN 
-    photos ph ON ph.post_id = p.id
-WHERE 
-    u.family_id = $1
-GROUP BY 
-    p.id, u.name, f.name
-ORDER BY 
-    p.created_at DESC
-LIMIT $2
+const purgeDeletedPhotos = `-- name: PurgeDeletedPhotos :many
+DELETE FROM photos AS ph
+USING posts AS p
+WHERE ph.post_id = p.id
+    AND (ph.deleted_at < $1::timestamp OR p.deleted_at < $1::timestamp)
+RETURNING ph.url, ph.thumb_url, ph.medium_url
 `
 
-type GetPostsByUserFamilyAggregatedParams struct {
-	FamilyID pgtype.Int8
-	Limit    int32
+type PurgeDeletedPhotosRow struct {
+	Url       string
+	ThumbUrl  string
+	MediumUrl string
 }
 
-type GetPostsByUserFamilyAggregatedRow struct {
-	PostID          int64
-	PostCreatedAt   pgtype.Timestamp
-	PostUpdatedAt   pgtype.Timestamp
-	PostDescription string
-	UserName        string
-	FamilyName      string
-	Photos          interface{}
-}
-
-func (q *Queries) GetPostsByUserFamilyAggregated(ctx context.Context, arg GetPostsByUserFamilyAggregatedParams) ([]GetPostsByUserFamilyAggregatedRow, error) {
-	rows, err := q.db.Query(ctx, getPostsByUserFamilyAggregated, arg.FamilyID, arg.Limit)
+func (q *Queries) PurgeDeletedPhotos(ctx context.Context, before pgtype.Timestamp) ([]PurgeDeletedPhotosRow, error) {
+	rows, err := q.db.Query(ctx, purgeDeletedPhotos, before)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPostsByUserFamilyAggregatedRow
+	var items []PurgeDeletedPhotosRow
 	for rows.Next() {
-		var i GetPostsByUserFamilyAggregatedRow
+		var i PurgeDeletedPhotosRow
 		if err := rows.Scan(
-			&i.PostID,
-			&i.PostCreatedAt,
-			&i.PostUpdatedAt,
-			&i.PostDescription,
-			&i.UserName,
-			&i.FamilyName,
-			&i.Photos,
+			&i.Url,
+			&i.ThumbUrl,
+			&i.MediumUrl,
 		); err != nil {
 			return nil, err
 		}
@@ -433,18 +762,99 @@ func (q *Queries) GetPostsByUserFamilyAggregated(ctx context.Context, arg GetPos
 	return items, nil
 }
 
-const updatePhotosPostId = `-- name: UpdatePhotosPostId :exec
+const restorePhoto = `-- name: RestorePhoto :execrows
+UPDATE photos SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+`
+
+type RestorePhotoParams struct {
+	ID     string
+	UserID string
+}
+
+func (q *Queries) RestorePhoto(ctx context.Context, arg RestorePhotoParams) (int64, error) {
+	result, err := q.db.Exec(ctx, restorePhoto, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setPhotosSortOrder = `-- name: SetPhotosSortOrder :exec
 UPDATE photos
-SET post_id = $1
-WHERE id = ANY($2::string[])
+SET sort_order = array_position($1::text[], id)
+WHERE post_id = $2 AND id = ANY($1::text[])
 `
 
-type UpdatePhotosPostIdParams struct {
-	PostID  pgtype.Int8
-	Column2 []string
+type SetPhotosSortOrderParams struct {
+	Ids    []string
+	PostID pgtype.Int8
 }
 
-func (q *Queries) UpdatePhotosPostId(ctx context.Context, arg UpdatePhotosPostIdParams) error {
-	_, err := q.db.Exec(ctx, updatePhotosPostId, arg.PostID, arg.Column2)
+// numbers the photos of a post in the order of ids
+func (q *Queries) SetPhotosSortOrder(ctx context.Context, arg SetPhotosSortOrderParams) error {
+	_, err := q.db.Exec(ctx, setPhotosSortOrder, arg.Ids, arg.PostID)
 	return err
 }
+
+const trashPhoto = `-- name: TrashPhoto :execrows
+UPDATE photos SET deleted_at = NOW()
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+`
+
+type TrashPhotoParams struct {
+	ID     string
+	UserID string
+}
+
+func (q *Queries) TrashPhoto(ctx context.Context, arg TrashPhotoParams) (int64, error) {
+	result, err := q.db.Exec(ctx, trashPhoto, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updatePhotosPostId = `-- name: UpdatePhotosPostId :many
+UPDATE photos AS ph
+SET post_id = $1, sort_order = NULL, updated_at = NOW()
+FROM posts AS p
+WHERE ph.post_id = p.id AND ph.id = ANY($2::text[])
+    AND ph.user_id = $3 AND ph.deleted_at IS NULL
+    AND p.family_id = $4 AND p.deleted_at IS NULL
+RETURNING p.id
+`
+
+type UpdatePhotosPostIdParams struct {
+	PostID   pgtype.Int8
+	Ids      []string
+	UserID   string
+	FamilyID int64
+}
+
+// moves the user's photos from their other posts in the family, they go after the photos already there.
+// returns the post each photo came from
+func (q *Queries) UpdatePhotosPostId(ctx context.Context, arg UpdatePhotosPostIdParams) ([]int64, error) {
+	rows, err := q.db.Query(ctx, updatePhotosPostId,
+		arg.PostID,
+		arg.Ids,
+		arg.UserID,
+		arg.FamilyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
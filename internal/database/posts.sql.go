@@ -11,10 +11,24 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const clearMovedFeaturedPhotos = `-- name: ClearMovedFeaturedPhotos :exec
+UPDATE posts AS p
+SET featured_photo_id = NULL
+WHERE p.user_id = $1 AND p.featured_photo_id IS NOT NULL AND NOT EXISTS (
+    SELECT 1 FROM photos AS ph WHERE ph.id = p.featured_photo_id AND ph.post_id = p.id
+)
+`
+
+// a featured photo moved to another post no longer features in the one it left
+func (q *Queries) ClearMovedFeaturedPhotos(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, clearMovedFeaturedPhotos, userID)
+	return err
+}
+
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts (description, featured_photo_id, user_id, family_id, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, created_at, updated_at, description, featured_photo_id, user_id, family_id
+INSERT INTO posts (description, featured_photo_id, user_id, family_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, updated_at, description, featured_photo_id, user_id, family_id, upload_batch, deleted_at
 `
 
 type CreatePostParams struct {
@@ -22,8 +36,6 @@ type CreatePostParams struct {
 	FeaturedPhotoID pgtype.Text
 	UserID          string
 	FamilyID        int64
-	CreatedAt       pgtype.Timestamp
-	UpdatedAt       pgtype.Timestamp
 }
 
 func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
@@ -32,8 +44,6 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.FeaturedPhotoID,
 		arg.UserID,
 		arg.FamilyID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
 	)
 	var i Post
 	err := row.Scan(
@@ -44,18 +54,266 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.FeaturedPhotoID,
 		&i.UserID,
 		&i.FamilyID,
+		&i.UploadBatch,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getFamilyPostAggregated = `-- name: GetFamilyPostAggregated :one
+SELECT
+    p.id AS post_id,
+    p.created_at AS post_created_at,
+    p.updated_at AS post_updated_at,
+    p.description AS post_description,
+    p.featured_photo_id AS post_featured_photo_id,
+    p.user_id = $3 AS is_my_post,
+    u.name AS user_name,
+    f.name AS family_name,
+    (SELECT COUNT(*) FROM comments AS c WHERE c.post_id = p.id) AS comment_count,
+    (SELECT json_agg(json_build_object('emoji', r.emoji, 'count', r.count, 'users', r.users, 'mine', r.mine) ORDER BY r.first_at)
+        FROM (
+            SELECT re.emoji, COUNT(*) AS count, json_agg(ru.name ORDER BY re.created_at) AS users,
+                bool_or(re.user_id = $3) AS mine, MIN(re.created_at) AS first_at
+            FROM reactions AS re
+                JOIN users AS ru ON re.user_id = ru.id
+            WHERE re.post_id = p.id
+            GROUP BY re.emoji
+        ) AS r) AS reactions,
+    json_arrayagg(json_build_object(
+        'photo_id', ph.id,
+        'photo_name', ph.name,
+        'photo_url', ph.url,
+        'photo_thumb_url', ph.thumb_url,
+        'photo_medium_url', ph.medium_url,
+        'media_type', ph.media_type,
+        'has_preview', ph.thumb_url <> ph.url
+    ) ORDER BY ph.id = p.featured_photo_id DESC, ph.sort_order ASC NULLS LAST, ph.modified_at ASC) AS photos
+FROM 
+    posts p
+JOIN 
+    users u ON p.user_id = u.id
+JOIN 
+    families f ON p.family_id = f.id
+JOIN 
+    photos ph ON ph.post_id = p.id AND ph.deleted_at IS NULL
+WHERE 
+    p.id = $1 AND p.family_id = $2 AND p.deleted_at IS NULL
+GROUP BY 
+    p.id, u.name, f.name
+`
+
+type GetFamilyPostAggregatedParams struct {
+	ID       int64
+	FamilyID int64
+	UserID   string
+}
+
+type GetFamilyPostAggregatedRow struct {
+	PostID              int64
+	PostCreatedAt       pgtype.Timestamp
+	PostUpdatedAt       pgtype.Timestamp
+	PostDescription     string
+	PostFeaturedPhotoID pgtype.Text
+	IsMyPost            bool
+	UserName            string
+	FamilyName          string
+	CommentCount        int64
+	Reactions           interface{}
+	Photos              interface{}
+}
+
+func (q *Queries) GetFamilyPostAggregated(ctx context.Context, arg GetFamilyPostAggregatedParams) (GetFamilyPostAggregatedRow, error) {
+	row := q.db.QueryRow(ctx, getFamilyPostAggregated, arg.ID, arg.FamilyID, arg.UserID)
+	var i GetFamilyPostAggregatedRow
+	err := row.Scan(
+		&i.PostID,
+		&i.PostCreatedAt,
+		&i.PostUpdatedAt,
+		&i.PostDescription,
+		&i.PostFeaturedPhotoID,
+		&i.IsMyPost,
+		&i.UserName,
+		&i.FamilyName,
+		&i.CommentCount,
+		&i.Reactions,
+		&i.Photos,
+	)
+	return i, err
+}
+
+const getOrCreateBatchPost = `-- name: GetOrCreateBatchPost :one
+INSERT INTO posts (description, user_id, family_id, upload_batch)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, upload_batch) DO UPDATE SET updated_at = NOW()
+RETURNING id, created_at, updated_at, description, featured_photo_id, user_id, family_id, upload_batch, deleted_at
+`
+
+type GetOrCreateBatchPostParams struct {
+	Description string
+	UserID      string
+	FamilyID    int64
+	UploadBatch pgtype.Text
+}
+
+func (q *Queries) GetOrCreateBatchPost(ctx context.Context, arg GetOrCreateBatchPostParams) (Post, error) {
+	row := q.db.QueryRow(ctx, getOrCreateBatchPost,
+		arg.Description,
+		arg.UserID,
+		arg.FamilyID,
+		arg.UploadBatch,
+	)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Description,
+		&i.FeaturedPhotoID,
+		&i.UserID,
+		&i.FamilyID,
+		&i.UploadBatch,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const getPost = `-- name: GetPost :one
-SELECT id, created_at, updated_at, description, featured_photo_id, user_id, family_id FROM posts
-WHERE id=$1
-LIMIT 1
+const getTrashedPosts = `-- name: GetTrashedPosts :many
+SELECT p.id, p.description, p.deleted_at, COUNT(ph.id) AS photo_count
+FROM posts AS p
+    LEFT JOIN photos AS ph ON ph.post_id = p.id AND ph.deleted_at IS NULL
+WHERE p.user_id = $1 AND p.family_id = $2 AND p.deleted_at IS NOT NULL
+GROUP BY p.id
+ORDER BY p.deleted_at DESC
+`
+
+type GetTrashedPostsParams struct {
+	UserID   string
+	FamilyID int64
+}
+
+type GetTrashedPostsRow struct {
+	ID          int64
+	Description string
+	DeletedAt   pgtype.Timestamp
+	PhotoCount  int64
+}
+
+func (q *Queries) GetTrashedPosts(ctx context.Context, arg GetTrashedPostsParams) ([]GetTrashedPostsRow, error) {
+	rows, err := q.db.Query(ctx, getTrashedPosts, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTrashedPostsRow
+	for rows.Next() {
+		var i GetTrashedPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Description,
+			&i.DeletedAt,
+			&i.PhotoCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedPosts = `-- name: PurgeDeletedPosts :execrows
+DELETE FROM posts
+WHERE deleted_at < $1::timestamp
+`
+
+func (q *Queries) PurgeDeletedPosts(ctx context.Context, before pgtype.Timestamp) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeDeletedPosts, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restorePost = `-- name: RestorePost :execrows
+UPDATE posts SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+`
+
+type RestorePostParams struct {
+	ID     int64
+	UserID string
+}
+
+func (q *Queries) RestorePost(ctx context.Context, arg RestorePostParams) (int64, error) {
+	result, err := q.db.Exec(ctx, restorePost, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const trashEmptyPosts = `-- name: TrashEmptyPosts :execrows
+UPDATE posts AS p SET deleted_at = NOW()
+WHERE p.id = ANY($1::bigint[]) AND p.user_id = $2 AND p.deleted_at IS NULL
+    AND NOT EXISTS (SELECT 1 FROM photos AS ph WHERE ph.post_id = p.id AND ph.deleted_at IS NULL)
+`
+
+type TrashEmptyPostsParams struct {
+	Ids    []int64
+	UserID string
+}
+
+// trashes those of the user's posts that have no photos left
+func (q *Queries) TrashEmptyPosts(ctx context.Context, arg TrashEmptyPostsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, trashEmptyPosts, arg.Ids, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const trashPost = `-- name: TrashPost :execrows
+UPDATE posts SET deleted_at = NOW()
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+`
+
+type TrashPostParams struct {
+	ID     int64
+	UserID string
+}
+
+func (q *Queries) TrashPost(ctx context.Context, arg TrashPostParams) (int64, error) {
+	result, err := q.db.Exec(ctx, trashPost, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updatePost = `-- name: UpdatePost :one
+UPDATE posts
+SET description = $3, featured_photo_id = $4, updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, description, featured_photo_id, user_id, family_id, upload_batch, deleted_at
 `
 
-func (q *Queries) GetPost(ctx context.Context, id int64) (Post, error) {
-	row := q.db.QueryRow(ctx, getPost, id)
+type UpdatePostParams struct {
+	ID              int64
+	UserID          string
+	Description     string
+	FeaturedPhotoID pgtype.Text
+}
+
+func (q *Queries) UpdatePost(ctx context.Context, arg UpdatePostParams) (Post, error) {
+	row := q.db.QueryRow(ctx, updatePost,
+		arg.ID,
+		arg.UserID,
+		arg.Description,
+		arg.FeaturedPhotoID,
+	)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -65,6 +323,8 @@ func (q *Queries) GetPost(ctx context.Context, id int64) (Post, error) {
 		&i.FeaturedPhotoID,
 		&i.UserID,
 		&i.FamilyID,
+		&i.UploadBatch,
+		&i.DeletedAt,
 	)
 	return i, err
 }
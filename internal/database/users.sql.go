@@ -12,9 +12,9 @@ import (
 )
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name, apikey, password, family_id)
-VALUES ($1, NOW(), NOW(), $2, encode(sha256(random()::text::bytea), 'hex'), $3, $4)
-RETURNING id, created_at, updated_at, name, apikey, family_id, password
+INSERT INTO users (id, created_at, updated_at, name, password, family_id)
+VALUES ($1, NOW(), NOW(), $2, $3, $4)
+RETURNING id, created_at, updated_at, name, apikey_hash, family_id, password
 `
 
 type CreateUserParams struct {
@@ -37,7 +37,27 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
-		&i.Apikey,
+		&i.ApikeyHash,
+		&i.FamilyID,
+		&i.Password,
+	)
+	return i, err
+}
+
+const getUserByApiKey = `-- name: GetUserByApiKey :one
+SELECT id, created_at, updated_at, name, apikey_hash, family_id, password FROM users
+WHERE apikey_hash=$1
+`
+
+func (q *Queries) GetUserByApiKey(ctx context.Context, apikeyHash pgtype.Text) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByApiKey, apikeyHash)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.ApikeyHash,
 		&i.FamilyID,
 		&i.Password,
 	)
@@ -45,7 +65,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, name, apikey, family_id, password FROM users 
+SELECT id, created_at, updated_at, name, apikey_hash, family_id, password FROM users 
 WHERE ID = $1
 `
 
@@ -57,7 +77,7 @@ func (q *Queries) GetUserByID(ctx context.Context, id string) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
-		&i.Apikey,
+		&i.ApikeyHash,
 		&i.FamilyID,
 		&i.Password,
 	)
@@ -65,7 +85,7 @@ func (q *Queries) GetUserByID(ctx context.Context, id string) (User, error) {
 }
 
 const getUserByName = `-- name: GetUserByName :one
-select id, created_at, updated_at, name, apikey, family_id, password FROM users 
+select id, created_at, updated_at, name, apikey_hash, family_id, password FROM users 
 WHERE name=$1
 `
 
@@ -77,7 +97,7 @@ func (q *Queries) GetUserByName(ctx context.Context, name string) (User, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
-		&i.Apikey,
+		&i.ApikeyHash,
 		&i.FamilyID,
 		&i.Password,
 	)
@@ -85,17 +105,21 @@ func (q *Queries) GetUserByName(ctx context.Context, name string) (User, error)
 }
 
 const getUsersByFamily = `-- name: GetUsersByFamily :many
-SELECT id, name FROM users
-WHERE family_id=$1
-ORDER BY created_at ASC
+SELECT u.id, u.name, m.created_at, (m.role = 'admin')::boolean AS is_admin
+    FROM family_memberships AS m
+    JOIN users AS u ON m.user_id = u.id
+    WHERE m.family_id=$1
+    ORDER BY m.created_at ASC
 `
 
 type GetUsersByFamilyRow struct {
-	ID   string
-	Name string
+	ID        string
+	Name      string
+	CreatedAt pgtype.Timestamp
+	IsAdmin   bool
 }
 
-func (q *Queries) GetUsersByFamily(ctx context.Context, familyID pgtype.Int8) ([]GetUsersByFamilyRow, error) {
+func (q *Queries) GetUsersByFamily(ctx context.Context, familyID int64) ([]GetUsersByFamilyRow, error) {
 	rows, err := q.db.Query(ctx, getUsersByFamily, familyID)
 	if err != nil {
 		return nil, err
@@ -104,7 +128,12 @@ func (q *Queries) GetUsersByFamily(ctx context.Context, familyID pgtype.Int8) ([
 	var items []GetUsersByFamilyRow
 	for rows.Next() {
 		var i GetUsersByFamilyRow
-		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.IsAdmin,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -114,3 +143,56 @@ func (q *Queries) GetUsersByFamily(ctx context.Context, familyID pgtype.Int8) ([
 	}
 	return items, nil
 }
+
+const reselectUserFamily = `-- name: ReselectUserFamily :exec
+UPDATE users
+SET family_id = (
+    SELECT m.family_id FROM family_memberships AS m
+        WHERE m.user_id = users.id
+        ORDER BY m.created_at ASC
+        LIMIT 1
+), updated_at = NOW()
+WHERE id = $1 AND family_id = $2
+`
+
+type ReselectUserFamilyParams struct {
+	ID       string
+	FamilyID pgtype.Int8
+}
+
+func (q *Queries) ReselectUserFamily(ctx context.Context, arg ReselectUserFamilyParams) error {
+	_, err := q.db.Exec(ctx, reselectUserFamily, arg.ID, arg.FamilyID)
+	return err
+}
+
+const setUserFamily = `-- name: SetUserFamily :exec
+UPDATE users
+SET family_id = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetUserFamilyParams struct {
+	ID       string
+	FamilyID pgtype.Int8
+}
+
+func (q *Queries) SetUserFamily(ctx context.Context, arg SetUserFamilyParams) error {
+	_, err := q.db.Exec(ctx, setUserFamily, arg.ID, arg.FamilyID)
+	return err
+}
+
+const updateUserApiKey = `-- name: UpdateUserApiKey :exec
+UPDATE users
+SET apikey_hash = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserApiKeyParams struct {
+	ID         string
+	ApikeyHash pgtype.Text
+}
+
+func (q *Queries) UpdateUserApiKey(ctx context.Context, arg UpdateUserApiKeyParams) error {
+	_, err := q.db.Exec(ctx, updateUserApiKey, arg.ID, arg.ApikeyHash)
+	return err
+}
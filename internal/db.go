@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	connectAttempts = 10
+	connectBackoff  = time.Second
+	maxBackoff      = 8 * time.Second
+)
+
+// NewPool connects to the database in GOOSE_DBSTRING, retrying while it comes up.
+// Pool sizing can be tuned with DB_MAX_CONNS, DB_MIN_CONNS, DB_MAX_CONN_LIFETIME and DB_HEALTH_CHECK_PERIOD.
+func NewPool(ctx context.Context) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(os.Getenv("GOOSE_DBSTRING"))
+	if err != nil {
+		return nil, err
+	}
+	if n, err := strconv.Atoi(os.Getenv("DB_MAX_CONNS")); err == nil && n > 0 {
+		cfg.MaxConns = int32(n)
+	}
+	if n, err := strconv.Atoi(os.Getenv("DB_MIN_CONNS")); err == nil && n >= 0 {
+		cfg.MinConns = int32(n)
+	}
+	if d, err := time.ParseDuration(os.Getenv("DB_MAX_CONN_LIFETIME")); err == nil {
+		cfg.MaxConnLifetime = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("DB_HEALTH_CHECK_PERIOD")); err == nil {
+		cfg.HealthCheckPeriod = d
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	backoff := connectBackoff
+	for attempt := 1; ; attempt++ {
+		err = pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+		if attempt == connectAttempts {
+			pool.Close()
+			return nil, err
+		}
+		log.Printf("database not ready (attempt %d/%d): %v", attempt, connectAttempts, err)
+		select {
+		case <-ctx.Done():
+			pool.Close()
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
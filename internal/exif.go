@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// PhotoMetadata is what the camera recorded about a photo, fields it didn't record are left zero
+type PhotoMetadata struct {
+	// TakenAt is the camera's wall clock time, cameras rarely record a timezone so it is kept in UTC as is
+	TakenAt      time.Time
+	CameraMake   string
+	CameraModel  string
+	LensModel    string
+	ExposureTime string
+	FNumber      float64
+	ISO          int
+	FocalLength  float64
+	HasLocation  bool
+	Latitude     float64
+	Longitude    float64
+	// Orientation is the EXIF orientation, 1 is upright and 0 means it was not recorded
+	Orientation int
+}
+
+// ReadMetadata parses the EXIF block of a JPEG or TIFF. ok is false when there is none.
+func ReadMetadata(r io.Reader) (meta PhotoMetadata, ok bool) {
+	x, err := exif.Decode(r)
+	// a broken sub directory, e.g. the maker notes, still leaves the rest usable
+	if x == nil || (err != nil && exif.IsCriticalError(err)) {
+		return meta, false
+	}
+	if t, err := x.DateTime(); err == nil {
+		meta.TakenAt = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	}
+	meta.CameraMake = exifString(x, exif.Make)
+	meta.CameraModel = exifString(x, exif.Model)
+	meta.LensModel = exifString(x, exif.LensModel)
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && num > 0 && den > 0 {
+			meta.ExposureTime = formatExposure(num, den)
+		}
+	}
+	meta.FNumber = exifFloat(x, exif.FNumber)
+	meta.FocalLength = exifFloat(x, exif.FocalLength)
+	if tag, err := x.Get(exif.ISOSpeedRatings); err == nil {
+		meta.ISO, _ = tag.Int(0)
+	}
+	if lat, long, err := x.LatLong(); err == nil {
+		meta.HasLocation = true
+		meta.Latitude = lat
+		meta.Longitude = long
+	}
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		meta.Orientation, _ = tag.Int(0)
+	}
+	return meta, true
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+func exifFloat(x *exif.Exif, name exif.FieldName) float64 {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// formatExposure writes shutter speeds the way cameras show them, 1/250 or 2 for whole seconds
+func formatExposure(num, den int64) string {
+	if num >= den {
+		return fmt.Sprintf("%g", float64(num)/float64(den))
+	}
+	return fmt.Sprintf("1/%d", (den+num/2)/num)
+}
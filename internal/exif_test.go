@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func shortEntry(tag uint16, v uint16) tiffEntry {
+	return tiffEntry{tag: tag, typ: 3, count: 1, data: binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+func rationalEntry(tag uint16, num, den uint32) tiffEntry {
+	data := binary.LittleEndian.AppendUint32(nil, num)
+	return tiffEntry{tag: tag, typ: 5, count: 1, data: binary.LittleEndian.AppendUint32(data, den)}
+}
+
+// exifJPEG builds a 16x8 JPEG with a little endian EXIF block holding the given IFD0 and EXIF sub IFD tags
+func exifJPEG(t *testing.T, ifd0, sub []tiffEntry) []byte {
+	return exifJPEGWithGPS(t, ifd0, sub, nil)
+}
+
+func exifJPEGWithGPS(t *testing.T, ifd0, sub, gps []tiffEntry) []byte {
+	t.Helper()
+	ifdSize := func(n int) uint32 { return uint32(2 + 12*n + 4) }
+	// sub directory pointers are patched in once we know where the directories land
+	var subs [][]tiffEntry
+	for _, d := range []struct {
+		tag     uint16
+		entries []tiffEntry
+	}{{0x8769, sub}, {0x8825, gps}} {
+		if len(d.entries) > 0 {
+			ifd0 = append(ifd0, tiffEntry{tag: d.tag, typ: 4, count: 1, data: make([]byte, 4)})
+			subs = append(subs, d.entries)
+		}
+	}
+	offset := 8 + ifdSize(len(ifd0))
+	for i, entries := range subs {
+		binary.LittleEndian.PutUint32(ifd0[len(ifd0)-len(subs)+i].data, offset)
+		offset += ifdSize(len(entries))
+	}
+	dataOffset := offset
+
+	var dataArea []byte
+	writeIFD := func(buf *bytes.Buffer, entries []tiffEntry) {
+		binary.Write(buf, binary.LittleEndian, uint16(len(entries)))
+		for _, e := range entries {
+			binary.Write(buf, binary.LittleEndian, e.tag)
+			binary.Write(buf, binary.LittleEndian, e.typ)
+			binary.Write(buf, binary.LittleEndian, e.count)
+			if len(e.data) <= 4 {
+				buf.Write(append(e.data, make([]byte, 4-len(e.data))...))
+				continue
+			}
+			binary.Write(buf, binary.LittleEndian, dataOffset+uint32(len(dataArea)))
+			dataArea = append(dataArea, e.data...)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(0))
+	}
+	tiff := &bytes.Buffer{}
+	tiff.WriteString("II*\x00")
+	binary.Write(tiff, binary.LittleEndian, uint32(8))
+	writeIFD(tiff, ifd0)
+	for _, entries := range subs {
+		writeIFD(tiff, entries)
+	}
+	tiff.Write(dataArea)
+
+	// black with a white block in the top left corner, to see where it ends up once rotated
+	src := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	draw.Draw(src, src.Bounds(), image.Black, image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(0, 0, 4, 4), image.White, image.Point{}, draw.Src)
+	img := &bytes.Buffer{}
+	assert.NoError(t, jpeg.Encode(img, src, nil))
+
+	out := &bytes.Buffer{}
+	out.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(out, binary.BigEndian, uint16(2+6+tiff.Len()))
+	out.WriteString("Exif\x00\x00")
+	out.Write(tiff.Bytes())
+	out.Write(img.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestReadMetadata(t *testing.T) {
+	data := exifJPEG(t,
+		[]tiffEntry{
+			asciiEntry(0x010F, "FUJIFILM"),
+			asciiEntry(0x0110, "X100V"),
+			shortEntry(0x0112, 6),
+		},
+		[]tiffEntry{
+			rationalEntry(0x829A, 1, 250),
+			rationalEntry(0x829D, 28, 10),
+			shortEntry(0x8827, 400),
+			asciiEntry(0x9003, "2024:07:14 16:05:09"),
+			rationalEntry(0x920A, 23, 1),
+		},
+	)
+
+	meta, ok := ReadMetadata(bytes.NewReader(data))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2024, 7, 14, 16, 5, 9, 0, time.UTC), meta.TakenAt)
+	assert.Equal(t, "FUJIFILM", meta.CameraMake)
+	assert.Equal(t, "X100V", meta.CameraModel)
+	assert.Equal(t, "1/250", meta.ExposureTime)
+	assert.InDelta(t, 2.8, meta.FNumber, 0.001)
+	assert.Equal(t, 400, meta.ISO)
+	assert.InDelta(t, 23.0, meta.FocalLength, 0.001)
+	assert.Equal(t, 6, meta.Orientation)
+	assert.False(t, meta.HasLocation)
+}
+
+func TestReadMetadataWithoutExif(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 8, 8))))
+
+	_, ok := ReadMetadata(bytes.NewReader(buf.Bytes()))
+	assert.False(t, ok)
+}
+
+func TestFormatExposure(t *testing.T) {
+	tests := []struct {
+		num, den int64
+		want     string
+	}{
+		{1, 250, "1/250"},
+		{10, 2500, "1/250"},
+		{1, 3, "1/3"},
+		{2, 1, "2"},
+		{5, 2, "2.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatExposure(tt.num, tt.den))
+		})
+	}
+}
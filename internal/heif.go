@@ -0,0 +1,382 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	_ "golang.org/x/image/webp"
+)
+
+// heifTimeout bounds converting one HEIF image
+const heifTimeout = time.Minute
+
+// ErrHEIFUnsupported is returned for HEIC and AVIF photos when libheif's heif-convert isn't installed
+var ErrHEIFUnsupported = &UploadError{"HEIF_NOT_SUPPORTED", "is a HEIC or AVIF photo, this server isn't set up for those yet"}
+
+var errBadHEIF = errors.New("malformed heif")
+
+func init() {
+	mime.AddExtensionType(".webp", "image/webp")
+	mime.AddExtensionType(".heic", "image/heic")
+	mime.AddExtensionType(".heif", "image/heif")
+	mime.AddExtensionType(".avif", "image/avif")
+}
+
+// IsHEIF reports whether a detected content type is one of the HEIF images browsers mostly can't show,
+// their renditions are made by converting them with libheif
+func IsHEIF(contentType string) bool {
+	switch contentType {
+	case "image/heic", "image/heif", "image/avif":
+		return true
+	}
+	return false
+}
+
+// heifBrands are the ftyp brands of HEIF stills, iPhones write heic and newer Androids avif
+var heifBrands = map[string]string{
+	"heic": "image/heic", "heix": "image/heic", "heim": "image/heic", "heis": "image/heic",
+	"avif": "image/avif",
+	"mif1": "image/heif",
+}
+
+// sniffHEIF looks at the major and compatible brands of an ftyp box, a generic mif1 file is AVIF
+// when it says it is compatible with it
+func sniffHEIF(head []byte) (string, bool) {
+	if len(head) < 12 || string(head[4:8]) != "ftyp" {
+		return "", false
+	}
+	contentType, ok := heifBrands[string(head[8:12])]
+	if contentType != "image/heif" {
+		return contentType, ok
+	}
+	size := min(int(binary.BigEndian.Uint32(head)), len(head))
+	for off := 16; off+4 <= size; off += 4 {
+		if string(head[off:off+4]) == "avif" {
+			return "image/avif", true
+		}
+	}
+	return contentType, true
+}
+
+// isoBox is a box of an ISO base media file, start and end are of its content after the header
+type isoBox struct {
+	typ        string
+	start, end int64
+}
+
+// readBoxes lists the boxes between start and end
+func readBoxes(r io.ReaderAt, start, end int64) ([]isoBox, error) {
+	var boxes []isoBox
+	header := make([]byte, 16)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return nil, errBadHEIF
+		}
+		size, headerSize := int64(binary.BigEndian.Uint32(header)), int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return nil, errBadHEIF
+			}
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:])), 16
+		}
+		if size < headerSize || pos+size > end {
+			return nil, errBadHEIF
+		}
+		boxes = append(boxes, isoBox{typ: string(header[4:8]), start: pos + headerSize, end: pos + size})
+		pos += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []isoBox, typ string) (isoBox, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return isoBox{}, false
+}
+
+// maxHEIFMeta is the most that is read of the meta box, it only describes the items so it is small
+const maxHEIFMeta = 1 << 20
+
+// extent is a run of bytes in the file holding part of an item
+type extent struct {
+	offset, length int64
+}
+
+// heifMetadataItems finds where the Exif and XMP items of a HEIF file are stored
+func heifMetadataItems(r io.ReaderAt, size int64) (exif, xmp []extent, err error) {
+	top, err := readBoxes(r, 0, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, ok := findBox(top, "meta")
+	if !ok || meta.end-meta.start > maxHEIFMeta {
+		return nil, nil, errBadHEIF
+	}
+	// meta is a full box, its children come after the version and flags
+	children, err := readBoxes(r, meta.start+4, meta.end)
+	if err != nil {
+		return nil, nil, err
+	}
+	iinf, ok1 := findBox(children, "iinf")
+	iloc, ok2 := findBox(children, "iloc")
+	if !ok1 || !ok2 {
+		return nil, nil, errBadHEIF
+	}
+	types, err := readItemTypes(r, iinf)
+	if err != nil {
+		return nil, nil, err
+	}
+	idat, _ := findBox(children, "idat")
+	locations, err := readItemLocations(r, iloc, idat)
+	if err != nil {
+		return nil, nil, err
+	}
+	for id, typ := range types {
+		switch typ {
+		case "Exif":
+			exif = append(exif, locations[id]...)
+		case "mime":
+			// the only mime item cameras write is the XMP packet
+			xmp = append(xmp, locations[id]...)
+		}
+	}
+	return exif, xmp, nil
+}
+
+func readBox(r io.ReaderAt, b isoBox) ([]byte, error) {
+	data := make([]byte, b.end-b.start)
+	if _, err := r.ReadAt(data, b.start); err != nil {
+		return nil, errBadHEIF
+	}
+	return data, nil
+}
+
+// readItemTypes maps item ids to their type from the item info box
+func readItemTypes(r io.ReaderAt, iinf isoBox) (map[uint32]string, error) {
+	data, err := readBox(r, iinf)
+	if err != nil || len(data) < 6 {
+		return nil, errBadHEIF
+	}
+	countSize := 2
+	if data[0] > 0 {
+		countSize = 4
+	}
+	entries, err := readBoxes(bytes.NewReader(data), int64(4+countSize), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	types := map[uint32]string{}
+	for _, e := range entries {
+		infe := data[e.start:e.end]
+		// only version 2 and 3 entries have an item type
+		if e.typ != "infe" || len(infe) < 4 || infe[0] < 2 {
+			continue
+		}
+		if infe[0] == 2 && len(infe) >= 12 {
+			types[uint32(binary.BigEndian.Uint16(infe[4:]))] = string(infe[8:12])
+		}
+		if infe[0] == 3 && len(infe) >= 14 {
+			types[binary.BigEndian.Uint32(infe[4:])] = string(infe[10:14])
+		}
+	}
+	return types, nil
+}
+
+// readItemLocations maps item ids to the extents of the file they are stored in, from the item location box
+func readItemLocations(r io.ReaderAt, iloc isoBox, idat isoBox) (map[uint32][]extent, error) {
+	data, err := readBox(r, iloc)
+	if err != nil || len(data) < 8 {
+		return nil, errBadHEIF
+	}
+	version := data[0]
+	p := heifReader{b: data, pos: 4, ok: true}
+	sizes := p.uint(2)
+	offsetSize, lengthSize := int(sizes>>12), int(sizes>>8&0xF)
+	baseOffsetSize, indexSize := int(sizes>>4&0xF), int(sizes&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count := p.uint(idSize)
+	locations := map[uint32][]extent{}
+	for i := uint64(0); i < count && p.ok; i++ {
+		id := uint32(p.uint(idSize))
+		method := uint64(0)
+		if version > 0 {
+			method = p.uint(2) & 0xF
+		}
+		p.uint(2) // data reference index, items are always in this file
+		base := p.uint(baseOffsetSize)
+		extents := p.uint(2)
+		for j := uint64(0); j < extents && p.ok; j++ {
+			p.uint(indexSize)
+			offset := int64(base + p.uint(offsetSize))
+			length := int64(p.uint(lengthSize))
+			switch method {
+			case 0:
+				locations[id] = append(locations[id], extent{offset, length})
+			case 1:
+				// stored inside the meta box's idat
+				locations[id] = append(locations[id], extent{idat.start + offset, length})
+			}
+		}
+	}
+	if !p.ok {
+		return nil, errBadHEIF
+	}
+	return locations, nil
+}
+
+// heifReader reads big endian numbers of the sizes iloc declares, ok turns false past the end
+type heifReader struct {
+	b   []byte
+	pos int
+	ok  bool
+}
+
+func (h *heifReader) uint(size int) uint64 {
+	if !h.ok || h.pos+size > len(h.b) {
+		h.ok = false
+		return 0
+	}
+	var v uint64
+	for _, c := range h.b[h.pos : h.pos+size] {
+		v = v<<8 | uint64(c)
+	}
+	h.pos += size
+	return v
+}
+
+// ScrubHEIFLocation applies the policy to the GPS tags in the Exif item of a HEIF file, editing it in
+// place so the boxes pointing into the file stay valid. An Exif item it can't make sense of and an XMP
+// packet mentioning GPS are blanked. It returns the metadata from before the location was touched.
+func ScrubHEIFLocation(f interface {
+	io.ReaderAt
+	io.WriterAt
+}, size int64, policy LocationPolicy) (meta PhotoMetadata, ok bool, err error) {
+	exif, xmp, err := heifMetadataItems(f, size)
+	if err != nil {
+		return PhotoMetadata{}, false, err
+	}
+	for _, items := range [][]extent{exif, xmp} {
+		for _, e := range items {
+			if e.offset < 0 || e.length < 0 || e.offset+e.length > size || e.length > maxHEIFMeta {
+				return PhotoMetadata{}, false, errBadHEIF
+			}
+		}
+	}
+
+	if len(exif) > 0 {
+		data, err := readExtents(f, exif)
+		if err != nil {
+			return PhotoMetadata{}, false, err
+		}
+		// the item starts with the offset of the TIFF header, past an optional Exif\0\0
+		var tiff []byte
+		if len(data) >= 4 {
+			if start := 4 + int64(binary.BigEndian.Uint32(data)); start < int64(len(data)) {
+				tiff = data[start:]
+			}
+		}
+		if tiff != nil {
+			meta, ok = ReadMetadata(bytes.NewReader(tiff))
+		}
+		if policy != LocationKeep {
+			if tiff == nil || scrubTIFF(tiff, policy) != nil {
+				clear(data)
+			}
+			if err := writeExtents(f, exif, data); err != nil {
+				return PhotoMetadata{}, false, err
+			}
+		}
+	}
+
+	if policy != LocationKeep && len(xmp) > 0 {
+		data, err := readExtents(f, xmp)
+		if err != nil {
+			return PhotoMetadata{}, false, err
+		}
+		if bytes.Contains(data, []byte("GPS")) {
+			// XMP may be padded with whitespace, readers skip a packet that is nothing else
+			copy(data, bytes.Repeat([]byte(" "), len(data)))
+			if err := writeExtents(f, xmp, data); err != nil {
+				return PhotoMetadata{}, false, err
+			}
+		}
+	}
+	return meta, ok, nil
+}
+
+func readExtents(r io.ReaderAt, extents []extent) ([]byte, error) {
+	var data []byte
+	for _, e := range extents {
+		part := make([]byte, e.length)
+		if _, err := r.ReadAt(part, e.offset); err != nil {
+			return nil, errBadHEIF
+		}
+		data = append(data, part...)
+	}
+	return data, nil
+}
+
+func writeExtents(w io.WriterAt, extents []extent, data []byte) error {
+	for _, e := range extents {
+		if _, err := w.WriteAt(data[:e.length], e.offset); err != nil {
+			return err
+		}
+		data = data[e.length:]
+	}
+	return nil
+}
+
+// DecodeHEIF converts the primary image of the HEIC or AVIF file at path, turned the way it displays.
+// There is no decoder in Go, libheif's heif-convert writes it out as a PNG.
+func DecodeHEIF(ctx context.Context, path string) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, heifTimeout)
+	defer cancel()
+	dir, err := os.MkdirTemp("", "heif-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "image.png")
+	err = exec.CommandContext(ctx, "heif-convert", path, out).Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, ErrHEIFUnsupported
+	}
+	if err != nil {
+		return nil, ErrCorruptImage
+	}
+	// files holding several images get numbered, the first is the primary one
+	for _, name := range []string{"image.png", "image-1.png"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		img, err := DecodeImage(f)
+		if err != nil {
+			return nil, ErrCorruptImage
+		}
+		return img, nil
+	}
+	return nil, ErrCorruptImage
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func isoBoxBytes(typ string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// testHEIF builds the boxes of a HEIC file around the Exif block of gpsJPEG and an XMP packet, the
+// image item itself is only a few placeholder bytes
+func testHEIF(t *testing.T) []byte {
+	t.Helper()
+	jpg := gpsJPEG(t)
+	tiff := jpg[4+2+6 : 4+int(binary.BigEndian.Uint16(jpg[4:6]))]
+	items := [][]byte{
+		[]byte("not really hevc"),
+		append(append(binary.BigEndian.AppendUint32(nil, 6), "Exif\x00\x00"...), tiff...),
+		[]byte(`<x:xmpmeta><rdf:Description exif:GPSLatitude="36,50.86S"/></x:xmpmeta>`),
+	}
+	infe := func(id uint16, typ string) []byte {
+		b := []byte{2, 0, 0, 0}
+		b = binary.BigEndian.AppendUint16(b, id)
+		b = append(b, 0, 0)
+		return isoBoxBytes("infe", append(append(b, typ...), 0))
+	}
+	iinf := isoBoxBytes("iinf", []byte{0, 0, 0, 0, 0, 3}, infe(1, "hvc1"), infe(2, "Exif"), infe(3, "mime"))
+
+	// iloc is written twice, first to learn its size and then with the real offsets into mdat
+	iloc := func(mdatStart int) []byte {
+		b := []byte{0, 0, 0, 0, 0x44, 0x00}
+		b = binary.BigEndian.AppendUint16(b, uint16(len(items)))
+		offset := mdatStart
+		for i, item := range items {
+			b = binary.BigEndian.AppendUint16(b, uint16(i+1))
+			b = append(b, 0, 0, 0, 1)
+			b = binary.BigEndian.AppendUint32(b, uint32(offset))
+			b = binary.BigEndian.AppendUint32(b, uint32(len(item)))
+			offset += len(item)
+		}
+		return isoBoxBytes("iloc", b)
+	}
+	ftyp := isoBoxBytes("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	meta := func(mdatStart int) []byte { return isoBoxBytes("meta", []byte{0, 0, 0, 0}, iinf, iloc(mdatStart)) }
+	mdatStart := len(ftyp) + len(meta(0)) + 8
+	return bytes.Join([][]byte{ftyp, meta(mdatStart), isoBoxBytes("mdat", items...)}, nil)
+}
+
+func TestScrubHEIFLocation(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       LocationPolicy
+		wantLocation bool
+		wantLat      float64
+		wantXMP      bool
+	}{
+		{name: "keep", policy: LocationKeep, wantLocation: true, wantLat: -36.8477, wantXMP: true},
+		{name: "coarsen", policy: LocationCoarsen, wantLocation: true, wantLat: -36.85},
+		{name: "strip", policy: LocationStrip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testHEIF(t)
+			path := filepath.Join(t.TempDir(), "photo.heic")
+			assert.NoError(t, os.WriteFile(path, data, 0600))
+			f, err := os.OpenFile(path, os.O_RDWR, 0)
+			assert.NoError(t, err)
+			defer f.Close()
+
+			meta, ok, err := ScrubHEIFLocation(f, int64(len(data)), tt.policy)
+			assert.NoError(t, err)
+			// the metadata is read before the location is touched
+			assert.True(t, ok)
+			assert.True(t, meta.HasLocation)
+			assert.Equal(t, "Apple", meta.CameraMake)
+
+			// scrubbing again reads what was left in the file
+			scrubbed, _ := os.ReadFile(path)
+			assert.Equal(t, len(data), len(scrubbed))
+			after, ok, err := ScrubHEIFLocation(f, int64(len(scrubbed)), LocationKeep)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantLocation, after.HasLocation)
+			if tt.wantLocation {
+				assert.InDelta(t, tt.wantLat, after.Latitude, 0.0001)
+			}
+			assert.Equal(t, 6, after.Orientation)
+			assert.Equal(t, tt.wantXMP, bytes.Contains(scrubbed, []byte("GPSLatitude")))
+		})
+	}
+}
+
+func TestScrubHEIFLocationRejectsGarbage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.heic")
+	data := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic\x00\x00\x00\x10meta")
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	assert.NoError(t, err)
+	defer f.Close()
+	_, _, err = ScrubHEIFLocation(f, int64(len(data)), LocationStrip)
+	assert.Error(t, err)
+}
+
+func TestSniffHEIF(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"iphone heic", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic", "image/heic"},
+		{"avif", "\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf", "image/avif"},
+		{"generic heif compatible with avif", "\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1avif", "image/avif"},
+		{"generic heif", "\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1heic", "image/heif"},
+		{"webp", "RIFF\x1a\x00\x00\x00WEBPVP8L", "image/webp"},
+		{"mp4 is still a video", "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00isom", "video/mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sniffContentType([]byte(tt.head)))
+		})
+	}
+}
+
+func TestDecodeImageWebP(t *testing.T) {
+	// a 1x1 lossless WebP
+	data, _ := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	img, err := DecodeImage(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, img.Bounds().Dx())
+
+	store, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	saved, err := SaveFile(context.Background(), store, bytes.NewReader(data), LocationStrip, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/webp", saved.Original.ContentType)
+	assert.NotEqual(t, saved.Original.Key, saved.Thumb.Key)
+}
+
+func TestSaveFileHEIC(t *testing.T) {
+	store, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	_, err = SaveFile(context.Background(), store, bytes.NewReader(testHEIF(t)), LocationStrip, nil)
+	if _, lookErr := exec.LookPath("heif-convert"); lookErr != nil {
+		assert.ErrorIs(t, err, ErrHEIFUnsupported)
+		return
+	}
+	// the placeholder image data can't be decoded
+	assert.EqualError(t, err, "COULD_NOT_DECODE_IMAGE")
+}
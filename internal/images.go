@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/disintegration/imaging"
+)
+
+// Rendition is a resized copy of an uploaded image
+type Rendition struct {
+	Suffix  string
+	MaxSide int
+}
+
+var (
+	// ThumbRendition is sized for the posts feed carousel
+	ThumbRendition = Rendition{Suffix: "_thumb", MaxSide: 640}
+	// MediumRendition is sized for viewing a single photo
+	MediumRendition = Rendition{Suffix: "_medium", MaxSide: 1600}
+)
+
+const renditionQuality = 82
+
+// IsImage reports whether a detected content type can be decoded into renditions
+func IsImage(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/jpg", "image/gif", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// DecodeImage decodes a JPEG, PNG, GIF or WebP, taking the first frame of an animation.
+// JPEGs are turned upright using their EXIF orientation, the renditions are encoded without EXIF
+// so they would otherwise show phone photos sideways. Browsers already honour the tag on originals.
+func DecodeImage(r io.Reader) (image.Image, error) {
+	return imaging.Decode(r, imaging.AutoOrientation(true))
+}
+
+// Render resizes src to fit the rendition, keeping its aspect ratio, and encodes it as a JPEG.
+// Images already smaller than the rendition are re-encoded but never upscaled.
+func (rd Rendition) Render(src image.Image) ([]byte, error) {
+	img := imaging.Fit(src, rd.MaxSide, rd.MaxSide, imaging.Lanczos)
+	// JPEG has no alpha channel, flatten transparent PNGs and GIFs onto white
+	bg := imaging.New(img.Bounds().Dx(), img.Bounds().Dy(), color.White)
+	img = imaging.Overlay(bg, img, image.Pt(0, 0), 1)
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(renditionQuality)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
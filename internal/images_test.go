@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.NRGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestRenditionRender(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		rendition  Rendition
+		wantWidth  int
+		wantHeight int
+	}{
+		{"landscape thumb", 2000, 1000, ThumbRendition, 640, 320},
+		{"portrait medium", 1000, 4000, MediumRendition, 400, 1600},
+		{"small images are not upscaled", 100, 50, ThumbRendition, 100, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := DecodeImage(bytes.NewReader(testPNG(t, tt.width, tt.height)))
+			assert.NoError(t, err)
+
+			data, err := tt.rendition.Render(src)
+			assert.NoError(t, err)
+
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.Equal(t, "jpeg", format)
+			assert.Equal(t, tt.wantWidth, cfg.Width)
+			assert.Equal(t, tt.wantHeight, cfg.Height)
+		})
+	}
+}
+
+func TestDecodeImageOrientation(t *testing.T) {
+	tests := []struct {
+		name        string
+		orientation uint16
+		wantW       int
+		wantH       int
+		// wantCorner is where the white top left corner of the stored image is shown
+		wantCorner image.Point
+	}{
+		{name: "upright", orientation: 1, wantW: 16, wantH: 8, wantCorner: image.Pt(0, 0)},
+		{name: "rotated 90", orientation: 6, wantW: 8, wantH: 16, wantCorner: image.Pt(7, 0)},
+		{name: "rotated 270", orientation: 8, wantW: 8, wantH: 16, wantCorner: image.Pt(0, 15)},
+		{name: "upside down", orientation: 3, wantW: 16, wantH: 8, wantCorner: image.Pt(15, 7)},
+	}
+	brightness := func(img image.Image, p image.Point) uint8 {
+		return color.GrayModel.Convert(img.At(p.X, p.Y)).(color.Gray).Y
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := exifJPEG(t, []tiffEntry{shortEntry(0x0112, tt.orientation)}, nil)
+			img, err := DecodeImage(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantW, img.Bounds().Dx())
+			assert.Equal(t, tt.wantH, img.Bounds().Dy())
+			b := img.Bounds()
+			for _, corner := range []image.Point{b.Min, {b.Max.X - 1, b.Min.Y}, {b.Min.X, b.Max.Y - 1}, b.Max.Sub(image.Pt(1, 1))} {
+				if corner == tt.wantCorner.Add(b.Min) {
+					assert.Greater(t, brightness(img, corner), uint8(200), "corner %v", corner)
+				} else {
+					assert.Less(t, brightness(img, corner), uint8(50), "corner %v", corner)
+				}
+			}
+		})
+	}
+}
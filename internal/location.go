@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// LocationPolicy is what a family wants done with GPS EXIF in the originals people can download
+type LocationPolicy string
+
+const (
+	LocationKeep LocationPolicy = "keep"
+	// LocationCoarsen rounds the position to two decimal places, about a kilometre, and drops the other GPS tags
+	LocationCoarsen LocationPolicy = "coarsen"
+	LocationStrip   LocationPolicy = "strip"
+)
+
+func (p LocationPolicy) Valid() bool {
+	switch p {
+	case LocationKeep, LocationCoarsen, LocationStrip:
+		return true
+	}
+	return false
+}
+
+const (
+	gpsInfoTag          = 0x8825
+	gpsVersionTag       = 0x0000
+	gpsLatRefTag        = 0x0001
+	gpsLatTag           = 0x0002
+	gpsLongRefTag       = 0x0003
+	gpsLongTag          = 0x0004
+	coarseLocationScale = 100 // two decimal places
+)
+
+var errBadExif = errors.New("malformed exif")
+
+var exifHeader = []byte("Exif\x00\x00")
+
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// ScrubLocation applies the policy to the GPS tags of a JPEG and returns the new bytes, the rest of the
+// EXIF, like orientation and camera details, is left alone. Other formats are returned unchanged.
+func ScrubLocation(data []byte, policy LocationPolicy) []byte {
+	if policy == LocationKeep || len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		// the compressed image data follows start of scan, copy the rest as is
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) {
+			break
+		}
+		segment := append([]byte(nil), data[pos:end]...)
+		payload := segment[4:]
+		pos = end
+		if marker != 0xE1 {
+			out.Write(segment)
+			continue
+		}
+		switch {
+		case bytes.HasPrefix(payload, exifHeader):
+			// a segment we can't make sense of may still hold a location, so it goes
+			if err := scrubTIFF(payload[len(exifHeader):], policy); err != nil {
+				continue
+			}
+		case bytes.HasPrefix(payload, xmpHeader) && bytes.Contains(payload, []byte("GPS")):
+			continue
+		}
+		out.Write(segment)
+	}
+	out.Write(data[pos:])
+	return out.Bytes()
+}
+
+// readJPEGHeader reads the segments of a JPEG that come before the compressed image data, where the
+// EXIF lives, and leaves the rest in br. It stops early on anything that doesn't look like a segment.
+func readJPEGHeader(br *bufio.Reader) ([]byte, error) {
+	soi, err := br.Peek(2)
+	if err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil, nil
+	}
+	header := []byte{0xFF, 0xD8}
+	br.Discard(2)
+	for {
+		p, err := br.Peek(4)
+		if err != nil || p[0] != 0xFF || p[1] == 0xDA || p[1] == 0xD9 {
+			return header, nil
+		}
+		segment := make([]byte, 2+int(binary.BigEndian.Uint16(p[2:4])))
+		n, err := io.ReadFull(br, segment)
+		header = append(header, segment[:n]...)
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return header, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tiffReader struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func (t tiffReader) u16(off int) (uint16, bool) {
+	if off < 0 || off+2 > len(t.b) {
+		return 0, false
+	}
+	return t.order.Uint16(t.b[off:]), true
+}
+
+func (t tiffReader) u32(off int) (uint32, bool) {
+	if off < 0 || off+4 > len(t.b) {
+		return 0, false
+	}
+	return t.order.Uint32(t.b[off:]), true
+}
+
+type ifdEntry struct {
+	raw   []byte
+	tag   uint16
+	size  int
+	value uint32
+}
+
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+func (t tiffReader) entries(off int) ([]ifdEntry, bool) {
+	n, ok := t.u16(off)
+	if !ok || off+2+12*int(n)+4 > len(t.b) {
+		return nil, false
+	}
+	entries := make([]ifdEntry, 0, n)
+	for i := 0; i < int(n); i++ {
+		e := off + 2 + 12*i
+		typ := t.order.Uint16(t.b[e+2:])
+		count := t.order.Uint32(t.b[e+4:])
+		entries = append(entries, ifdEntry{
+			raw:   append([]byte(nil), t.b[e:e+12]...),
+			tag:   t.order.Uint16(t.b[e:]),
+			size:  tiffTypeSizes[typ] * int(count),
+			value: t.order.Uint32(t.b[e+8:]),
+		})
+	}
+	return entries, true
+}
+
+// scrubTIFF edits the GPS directory of an EXIF block in place
+func scrubTIFF(b []byte, policy LocationPolicy) error {
+	if len(b) < 8 {
+		return errBadExif
+	}
+	t := tiffReader{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return errBadExif
+	}
+	ifd0, _ := t.u32(4)
+	entries, ok := t.entries(int(ifd0))
+	if !ok {
+		return errBadExif
+	}
+	gpsOff := -1
+	for _, e := range entries {
+		if e.tag == gpsInfoTag {
+			gpsOff = int(e.value)
+		}
+	}
+	if gpsOff < 0 {
+		return nil
+	}
+	gps, ok := t.entries(gpsOff)
+	if !ok {
+		return errBadExif
+	}
+
+	kept := make([]ifdEntry, 0, len(gps))
+	for _, e := range gps {
+		keep := policy == LocationCoarsen &&
+			(e.tag == gpsVersionTag || e.tag == gpsLatRefTag || e.tag == gpsLatTag || e.tag == gpsLongRefTag || e.tag == gpsLongTag)
+		if keep && (e.tag == gpsLatTag || e.tag == gpsLongTag) {
+			keep = coarsenDegrees(t, e) == nil
+		}
+		if keep {
+			kept = append(kept, e)
+			continue
+		}
+		// values over four bytes live outside the directory, blank them too
+		if e.size > 4 && int(e.value)+e.size <= len(b) {
+			clear(b[e.value : int(e.value)+e.size])
+		}
+	}
+
+	// rewrite the directory with only the kept entries, it ends up shorter so blank what's left over
+	end := gpsOff + 2 + 12*len(gps) + 4
+	clear(b[gpsOff:end])
+	t.order.PutUint16(b[gpsOff:], uint16(len(kept)))
+	for i, e := range kept {
+		copy(b[gpsOff+2+12*i:], e.raw)
+	}
+	return nil
+}
+
+// coarsenDegrees rounds a degrees, minutes, seconds rational triple in place
+func coarsenDegrees(t tiffReader, e ifdEntry) error {
+	if e.size != 24 || int(e.value)+24 > len(t.b) {
+		return errBadExif
+	}
+	off := int(e.value)
+	var deg float64
+	for i, scale := range []float64{1, 60, 3600} {
+		num, _ := t.u32(off + 8*i)
+		den, _ := t.u32(off + 8*i + 4)
+		if den == 0 {
+			return errBadExif
+		}
+		deg += float64(num) / float64(den) / scale
+	}
+	deg = math.Round(deg*coarseLocationScale) / coarseLocationScale
+	whole := math.Floor(deg)
+	minutes := math.Round((deg - whole) * 60 * coarseLocationScale)
+	for i, v := range []uint32{uint32(whole), 1, uint32(minutes), coarseLocationScale, 0, 1} {
+		t.order.PutUint32(t.b[off+4*i:], v)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func degreesEntry(tag uint16, deg, min, secTimes100 uint32) tiffEntry {
+	var data []byte
+	for _, v := range []uint32{deg, 1, min, 1, secTimes100, 100} {
+		data = binary.LittleEndian.AppendUint32(data, v)
+	}
+	return tiffEntry{tag: tag, typ: 5, count: 3, data: data}
+}
+
+// a photo taken at 36°50'51.60"S 174°45'48.12"E with a few other GPS tags
+func gpsJPEG(t *testing.T) []byte {
+	return exifJPEGWithGPS(t,
+		[]tiffEntry{asciiEntry(0x010F, "Apple"), shortEntry(0x0112, 6)},
+		nil,
+		[]tiffEntry{
+			{tag: 0x0000, typ: 1, count: 4, data: []byte{2, 2, 0, 0}},
+			asciiEntry(0x0001, "S"),
+			degreesEntry(0x0002, 36, 50, 5160),
+			asciiEntry(0x0003, "E"),
+			degreesEntry(0x0004, 174, 45, 4812),
+			rationalEntry(0x0006, 3512, 100),
+		},
+	)
+}
+
+func TestScrubLocation(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       LocationPolicy
+		wantLocation bool
+		wantLat      float64
+		wantLong     float64
+	}{
+		{name: "keep", policy: LocationKeep, wantLocation: true, wantLat: -36.8477, wantLong: 174.7634},
+		{name: "coarsen", policy: LocationCoarsen, wantLocation: true, wantLat: -36.85, wantLong: 174.76},
+		{name: "strip", policy: LocationStrip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := gpsJPEG(t)
+			scrubbed := ScrubLocation(original, tt.policy)
+
+			meta, ok := ReadMetadata(bytes.NewReader(scrubbed))
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantLocation, meta.HasLocation)
+			if tt.wantLocation {
+				assert.InDelta(t, tt.wantLat, meta.Latitude, 0.0001)
+				assert.InDelta(t, tt.wantLong, meta.Longitude, 0.0001)
+			}
+			// everything else about the photo survives
+			assert.Equal(t, "Apple", meta.CameraMake)
+			assert.Equal(t, 6, meta.Orientation)
+			img, err := DecodeImage(bytes.NewReader(scrubbed))
+			assert.NoError(t, err)
+			assert.Equal(t, 8, img.Bounds().Dx())
+		})
+	}
+}
+
+func TestScrubLocationDropsAltitude(t *testing.T) {
+	scrubbed := ScrubLocation(gpsJPEG(t), LocationCoarsen)
+	// the altitude rational 3512/100 is blanked along with its directory entry
+	assert.False(t, bytes.Contains(scrubbed, binary.LittleEndian.AppendUint32(nil, 3512)))
+}
+
+func TestScrubLocationIgnoresOtherFormats(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	assert.Equal(t, buf.Bytes(), ScrubLocation(buf.Bytes(), LocationStrip))
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// pdfTimeout bounds rendering the first page of a document
+const pdfTimeout = 30 * time.Second
+
+// errPreviewUnsupported is returned when poppler's pdftoppm isn't installed, documents are still
+// accepted without a preview
+var errPreviewUnsupported = errors.New("PREVIEW_NOT_SUPPORTED")
+
+// PDFPreview renders the first page of the PDF at path, sized for the medium rendition
+func PDFPreview(ctx context.Context, path string) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, pdfTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "pdftoppm", "-q",
+		"-f", "1", "-l", "1", "-singlefile",
+		"-scale-to", strconv.Itoa(MediumRendition.MaxSide),
+		"-png", path, "-",
+	).Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, errPreviewUnsupported
+	}
+	// encrypted and damaged documents end up here
+	if err != nil || len(out) == 0 {
+		return nil, errors.New("COULD_NOT_READ_DOCUMENT")
+	}
+	return DecodeImage(bytes.NewReader(out))
+}
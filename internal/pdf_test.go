@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveFileDocumentWithoutPreview(t *testing.T) {
+	store, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	// nothing can render this, with or without pdftoppm, but it is still kept
+	saved, err := SaveFile(context.Background(), store, bytes.NewReader([]byte("%PDF-1.4\n%%EOF\n")), LocationStrip, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, MediaDocument, saved.MediaType)
+	assert.Equal(t, "application/pdf", saved.Original.ContentType)
+	assert.Equal(t, saved.Original.Key, saved.Thumb.Key)
+	assert.Equal(t, saved.Original.Key, saved.Medium.Key)
+	assert.False(t, saved.HasPerceptualHash)
+}
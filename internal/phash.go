@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+
+	"github.com/disintegration/imaging"
+)
+
+// NearDuplicateDistance is how many of the 64 hash bits may differ for two photos to count as the same picture,
+// resized and re-compressed copies usually land well under it
+const NearDuplicateDistance = 6
+
+// DHash is a difference hash of the image, each bit says whether a pixel of a 9x8 greyscale copy
+// is brighter than its right neighbour. It survives resizing, re-compression and small colour changes.
+func DHash(src image.Image) uint64 {
+	// transparent areas are compared the way the renditions show them, on white
+	bg := imaging.New(src.Bounds().Dx(), src.Bounds().Dy(), color.White)
+	img := imaging.Resize(imaging.Overlay(bg, src, image.Pt(0, 0), 1), 9, 8, imaging.Box)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luminance(img, x, y) > luminance(img, x+1, y) {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func luminance(img *image.NRGBA, x, y int) float64 {
+	c := img.NRGBAAt(x, y)
+	return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+}
+
+// HashDistance counts the bits two hashes differ in
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
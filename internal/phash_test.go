@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+)
+
+// wavyImage has smooth light and dark patches like a photo, so a difference hash has something to work with
+func wavyImage(w, h int, flip bool) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := uint8(128 + 120*math.Sin(fx*11)*math.Cos(fy*7+fx*3))
+			if flip {
+				v = 255 - v
+			}
+			img.Set(x, y, color.NRGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	src := wavyImage(800, 600, false)
+	hash := DHash(src)
+
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, imaging.Resize(src, 200, 150, imaging.Lanczos), &jpeg.Options{Quality: 40}))
+	smaller, err := DecodeImage(&buf)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		img  image.Image
+		near bool
+	}{
+		{"same image", src, true},
+		{"resized and re-compressed", smaller, true},
+		{"different image", wavyImage(800, 600, true), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := HashDistance(hash, DHash(tt.img))
+			assert.Equal(t, tt.near, distance <= NearDuplicateDistance, "distance %d", distance)
+		})
+	}
+}
+
+func TestHashDistance(t *testing.T) {
+	assert.Equal(t, 0, HashDistance(0xF0F0, 0xF0F0))
+	assert.Equal(t, 4, HashDistance(0xF0F0, 0xF0FF))
+	assert.Equal(t, 64, HashDistance(0, ^uint64(0)))
+}
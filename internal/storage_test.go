@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	info, err := store.Put(ctx, "abc.png", strings.NewReader("hello"), 5, "image/png")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc.png", info.Key)
+	assert.Equal(t, int64(5), info.Size)
+	assert.Equal(t, "image/png", info.ContentType)
+	assert.Equal(t, "/assets/uploads/abc.png", store.URL("abc.png"))
+
+	file, _, err := store.Get(ctx, "abc.png")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, "hello", string(body))
+
+	assert.NoError(t, store.Delete(ctx, "abc.png"))
+	_, err = store.Stat(ctx, "abc.png")
+	assert.Equal(t, ErrObjectNotFound, err)
+	// deleting twice is not an error
+	assert.NoError(t, store.Delete(ctx, "abc.png"))
+}
+
+func TestLocalStorageStaysInsideDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStorage(dir)
+	assert.NoError(t, err)
+
+	p, err := store.path("../../etc/passwd")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(p, dir))
+
+	_, err = store.Put(ctx, "", strings.NewReader("x"), 1, "")
+	assert.Error(t, err)
+}
+
+func TestKeyFromURL(t *testing.T) {
+	assert.Equal(t, "abc.png", KeyFromURL("/assets/uploads/abc.png"))
+}
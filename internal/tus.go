@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// TusVersion is the version of the tus resumable upload protocol that is spoken
+const TusVersion = "1.0.0"
+
+var errBadUploadMetadata = errors.New("INVALID_UPLOAD_METADATA")
+
+// ParseUploadMetadata decodes a tus Upload-Metadata header, comma separated keys each followed
+// by an optional base64 value
+func ParseUploadMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errBadUploadMetadata
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errBadUploadMetadata
+		}
+		meta[key] = string(decoded)
+	}
+	return meta, nil
+}
+
+// PartialUploads keeps the chunks of resumable uploads in storage until they are complete. Object
+// storage can't be appended to, so each chunk is its own object and the upload records which ones it
+// is made of, any instance can carry on with it.
+type PartialUploads struct {
+	store Storage
+}
+
+func NewPartialUploads(store Storage) *PartialUploads {
+	return &PartialUploads{store: store}
+}
+
+// chunkKey is where a chunk starting at offset is stored, two requests racing for the same offset
+// don't overwrite each other
+func chunkKey(id string, offset int64) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", errors.New("INVALID_UPLOAD_ID")
+	}
+	return fmt.Sprintf("partial-uploads/%s/%020d-%s", id, offset, randToken(4)), nil
+}
+
+// Append stores at most max bytes from r as the chunk of the upload starting at offset. Whatever
+// arrived before an error is still stored, so a dropped connection can carry on from there. Nothing
+// is stored when nothing arrived, the key is empty then.
+func (p *PartialUploads) Append(ctx context.Context, id string, offset int64, r io.Reader, max int64) (ObjectInfo, error) {
+	key, err := chunkKey(id, offset)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	// storage wants the size up front and the body may stop short of it
+	tmp, err := os.CreateTemp("", "chunk-*")
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	n, readErr := io.Copy(tmp, io.LimitReader(r, max))
+	if n == 0 {
+		return ObjectInfo{}, readErr
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return ObjectInfo{}, err
+	}
+	// the client hanging up cancels the request, what it sent is kept all the same
+	info, err := p.store.Put(context.WithoutCancel(ctx), key, tmp, n, "application/offset+octet-stream")
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info.Size = n
+	return info, readErr
+}
+
+// Open reads the chunks one after the other, as the file they were cut from
+func (p *PartialUploads) Open(ctx context.Context, chunks []string) io.ReadCloser {
+	return &chunkReader{ctx: ctx, store: p.store, keys: chunks}
+}
+
+// Remove deletes the chunks, removing ones that are already gone is not an error
+func (p *PartialUploads) Remove(ctx context.Context, chunks []string) error {
+	var errs []error
+	for _, key := range chunks {
+		if err := p.store.Delete(ctx, key); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// chunkReader opens each chunk when the one before it is used up
+type chunkReader struct {
+	ctx   context.Context
+	store Storage
+	keys  []string
+	cur   io.ReadCloser
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			file, _, err := c.store.Get(c.ctx, c.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			c.cur, c.keys = file, c.keys[1:]
+		}
+		n, err := c.cur.Read(b)
+		if err == io.EOF {
+			c.cur.Close()
+			c.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.cur == nil {
+		return nil
+	}
+	return c.cur.Close()
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", header: "", want: map[string]string{}},
+		{
+			name:   "values and a bare key",
+			header: "filename YmVhY2gucG5n, caption U3VubnkgZGF5,is_confidential",
+			want:   map[string]string{"filename": "beach.png", "caption": "Sunny day", "is_confidential": ""},
+		},
+		{name: "value that isn't base64", header: "filename beach.png", wantErr: true},
+		{name: "missing key", header: "filename YQ==,,", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := ParseUploadMetadata(tt.header)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, meta)
+		})
+	}
+}
+
+// brokenReader hands over data and then fails, like a connection dropping halfway through a chunk
+type brokenReader struct {
+	data string
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if b.data == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func TestPartialUploads(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	uploads := NewPartialUploads(store)
+
+	first, err := uploads.Append(ctx, "abc", 0, strings.NewReader("hello"), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), first.Size)
+	// nothing past the declared length is stored
+	second, err := uploads.Append(ctx, "abc", 5, strings.NewReader(" world!"), 6)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), second.Size)
+	// what arrived before the connection dropped is kept
+	third, err := uploads.Append(ctx, "abc", 11, &brokenReader{data: ", again"}, 100)
+	assert.Error(t, err)
+	assert.Equal(t, int64(7), third.Size)
+	// a chunk nothing arrived for isn't stored
+	empty, err := uploads.Append(ctx, "abc", 18, strings.NewReader(""), 100)
+	assert.NoError(t, err)
+	assert.Empty(t, empty.Key)
+	// chunks racing for the same offset are kept apart
+	racing, err := uploads.Append(ctx, "abc", 5, strings.NewReader(" there"), 100)
+	assert.NoError(t, err)
+	assert.NotEqual(t, second.Key, racing.Key)
+
+	chunks := []string{first.Key, second.Key, third.Key}
+	f := uploads.Open(ctx, chunks)
+	body, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	f.Close()
+	assert.Equal(t, "hello world, again", string(body))
+
+	assert.NoError(t, uploads.Remove(ctx, append(chunks, racing.Key)))
+	assert.NoError(t, uploads.Remove(ctx, chunks))
+	_, err = io.ReadAll(uploads.Open(ctx, chunks))
+	assert.Error(t, err)
+	_, err = uploads.Append(ctx, "../abc", 0, strings.NewReader("hello"), 100)
+	assert.Error(t, err)
+}
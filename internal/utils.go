@@ -1,18 +1,23 @@
 package internal
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"io"
 	"log"
-	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/donseba/go-htmx"
 )
@@ -53,6 +58,8 @@ func RespondWithErrorHtmx(h *htmx.Handler, w http.ResponseWriter, code int, mess
 	}
 	if h.IsHxRequest() {
 		h.TriggerError(message)
+		// the toast shows the error, 400s and 422s would otherwise swap the JSON into the page
+		h.ReSwap("none")
 	}
 	w.WriteHeader(code)
 	if _, err := w.Write(dat); err != nil {
@@ -95,6 +102,33 @@ func GetHeaderApiKey(_ http.ResponseWriter, r *http.Request) (string, error) {
 	return key, err
 }
 
+// HasApiKeyAuthorization reports whether the request uses an "ApiKey" or "Bearer" Authorization header
+func HasApiKeyAuthorization(r *http.Request) bool {
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return strings.EqualFold(scheme, "ApiKey") || strings.EqualFold(scheme, "Bearer")
+}
+
+// NewApiKey generates a random api key to hand to the user once
+func NewApiKey() string {
+	return randToken(32)
+}
+
+// NewInviteToken generates the secret part of a family invite link
+func NewInviteToken() string {
+	return randToken(24)
+}
+
+// NewUploadID names a resumable upload, it is part of the upload's url
+func NewUploadID() string {
+	return randToken(16)
+}
+
+// HashToken is how api keys and invite tokens are stored, so a leaked table doesn't leak working secrets
+func HashToken(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
 // FileGenerator handles uploaded files and sends them over a channel
 func FileGenerator(files []*multipart.FileHeader) <-chan *multipart.FileHeader {
 	ch := make(chan *multipart.FileHeader)
@@ -110,55 +144,263 @@ func FileGenerator(files []*multipart.FileHeader) <-chan *multipart.FileHeader {
 	return ch
 }
 
-func SaveFile(fileHeader *multipart.FileHeader) (string, error) {
-	file, err := fileHeader.Open()
-	if err != nil {
-		return "", err
+// SavedFile is an upload together with the renditions generated from it
+type SavedFile struct {
+	Original ObjectInfo
+	Thumb    ObjectInfo
+	Medium   ObjectInfo
+	// Metadata is only read from images, HasMetadata is false when there was no EXIF
+	Metadata    PhotoMetadata
+	HasMetadata bool
+	// ContentHash is the hex sha256 of the stored original
+	ContentHash string
+	// Duplicate is set when the blobs of an earlier upload were reused instead of storing new ones
+	Duplicate bool
+	// PerceptualHash is the DHash of images, HasPerceptualHash is false for other files
+	PerceptualHash    uint64
+	HasPerceptualHash bool
+	// MediaType is MediaImage, MediaVideo or MediaDocument, see SaveFile for where renditions come from
+	MediaType string
+	// Width and Height are of the original as it displays, Duration is only set for videos
+	Width    int
+	Height   int
+	Duration time.Duration
+}
+
+// UploadError is why a file was refused. Error is the code API clients get, Message explains it to
+// the person uploading. The messages of the errors here read after the file's name.
+type UploadError struct {
+	Code    string
+	Message string
+}
+
+func (e *UploadError) Error() string {
+	return e.Code
+}
+
+var (
+	ErrFileTooBig = &UploadError{"FILE_TOO_BIG",
+		"is too big, photos and documents can be up to 10MB and videos up to 200MB"}
+	ErrUnknownFileType = &UploadError{"COULD_NOT_DETERMINE_FILE_EXTENSION",
+		"isn't a kind of file that can be posted, try a photo, a video or a PDF"}
+	ErrCorruptImage = &UploadError{"COULD_NOT_DECODE_IMAGE",
+		"couldn't be opened, it may be damaged"}
+	ErrCorruptVideo = &UploadError{"COULD_NOT_READ_VIDEO",
+		"couldn't be played, it may be damaged"}
+	ErrQuotaExceeded = &UploadError{"QUOTA_EXCEEDED",
+		"doesn't fit, the family has used up its storage"}
+)
+
+// uploadTypes are the content types that can be uploaded, with the extension they are stored under
+var uploadTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"image/heic":      ".heic",
+	"image/heif":      ".heif",
+	"image/avif":      ".avif",
+	"application/pdf": ".pdf",
+	"video/mp4":       ".mp4",
+	"video/quicktime": ".mov",
+	"video/webm":      ".webm",
+}
+
+// FindStored looks up an earlier upload by content hash, ok is false when there is none
+type FindStored func(hash string) (saved SavedFile, ok bool, err error)
+
+// SaveFile validates an uploaded file and streams it into storage under a random key.
+// The file is spooled to a temporary file while it is hashed, only images are decoded into memory.
+// Images also get JPEG thumbnail and medium renditions, HEIC and AVIF photos are converted with libheif
+// for them, videos get them from a poster frame ffmpeg picks and PDFs from their first page.
+// Documents pdftoppm can't render use the original for both.
+// The location policy applies to the stored original, Metadata always has the exact position.
+// When find knows the stored original's hash its blobs are returned instead, find may be nil.
+func SaveFile(ctx context.Context, store Storage, file io.Reader, location LocationPolicy, find FindStored) (SavedFile, error) {
+	// one byte over the limit is enough to tell the file is too big
+	limited := &io.LimitedReader{R: file, N: MaxUploadSize + 1}
+	br := bufio.NewReader(limited)
+
+	// check file type, detectcontenttype only needs the first 512 bytes
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return SavedFile{}, err
 	}
-	defer file.Close()
-	// Get and print out file size
-	fileSize := fileHeader.Size
-	// validate file size
-	if fileSize > MaxUploadSize {
-		return "", errors.New("FILE_TOO_BIG")
+	detectedFileType := sniffContentType(head)
+	fileEnding, ok := uploadTypes[detectedFileType]
+	if !ok {
+		return SavedFile{}, ErrUnknownFileType
 	}
-	fileBytes, err := io.ReadAll(io.LimitReader(file, MaxUploadSize))
-	if err != nil {
-		return "", err
+	if IsVideo(detectedFileType) {
+		limited.N += MaxVideoUploadSize - MaxUploadSize
 	}
 
-	// check file type, detectcontenttype only needs the first 512 bytes
-	detectedFileType := http.DetectContentType(fileBytes[:512])
-	switch detectedFileType {
-	case "image/jpeg", "image/jpg", "image/gif", "image/png", "application/pdf":
-		break
-	default:
-		return "", errors.New("COULD_NOT_DETERMINE_FILE_EXTENSION")
+	// EXIF is in the segments ahead of the image data, which are all that's kept in memory
+	var src io.Reader = br
+	var meta PhotoMetadata
+	var hasMeta bool
+	if detectedFileType == "image/jpeg" {
+		header, err := readJPEGHeader(br)
+		if err != nil {
+			return SavedFile{}, err
+		}
+		meta, hasMeta = ReadMetadata(bytes.NewReader(header))
+		src = io.MultiReader(bytes.NewReader(ScrubLocation(header, location)), br)
+	}
+
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return SavedFile{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	// hashing after scrubbing means a family that changes its location policy stores the file again
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), src)
+	if err != nil {
+		return SavedFile{}, err
 	}
-	fileEndings, err := mime.ExtensionsByType(detectedFileType)
-	if err != nil || len(fileEndings) == 0 {
-		return "", errors.New("INVALID_FILE_TYPE")
+	if limited.N == 0 {
+		return SavedFile{}, ErrFileTooBig
+	}
+	// the Exif of HEIF and WebP files and the metadata of videos can be anywhere in them, so their
+	// location is scrubbed once they are all here
+	rehash := false
+	switch {
+	case IsHEIF(detectedFileType):
+		if meta, hasMeta, err = ScrubHEIFLocation(tmp, size, location); err != nil {
+			return SavedFile{}, ErrCorruptImage
+		}
+		rehash = true
+	case detectedFileType == "image/webp":
+		if size, meta, hasMeta, err = ScrubWebPLocation(tmp, size, location); err != nil {
+			return SavedFile{}, ErrCorruptImage
+		}
+		rehash = true
+	case IsVideo(detectedFileType) && location != LocationKeep:
+		if size, err = ScrubVideoLocation(ctx, tmp, detectedFileType); err != nil {
+			return SavedFile{}, err
+		}
+		rehash = true
+	}
+	if rehash {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return SavedFile{}, err
+		}
+		sum.Reset()
+		if _, err := io.Copy(sum, tmp); err != nil {
+			return SavedFile{}, err
+		}
+	}
+	hash := hex.EncodeToString(sum.Sum(nil))
+	if find != nil {
+		existing, ok, err := find(hash)
+		if err != nil {
+			return SavedFile{}, err
+		}
+		if ok {
+			existing.Metadata, existing.HasMetadata = meta, hasMeta
+			existing.ContentHash = hash
+			existing.Duplicate = true
+			return existing, nil
+		}
 	}
 
-	fileName := randToken(12)
-	newPath := filepath.Join("assets", "uploads", fileName) + fileEndings[len(fileEndings)-1]
-	newFile, err := os.OpenFile(filepath.Clean(newPath), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return SavedFile{}, err
+	}
+	saved := SavedFile{MediaType: MediaImage, Metadata: meta, HasMetadata: hasMeta, ContentHash: hash}
+	var img image.Image
+	switch {
+	case IsVideo(detectedFileType):
+		// probe before storing anything, a file ffmpeg can't read is turned away
+		saved.MediaType = MediaVideo
+		video, err := ProbeVideo(ctx, tmp.Name())
+		if err != nil {
+			return SavedFile{}, err
+		}
+		saved.Width, saved.Height, saved.Duration = video.Width, video.Height, video.Duration
+		img, err = VideoPoster(ctx, tmp.Name())
+		if err != nil {
+			return SavedFile{}, err
+		}
+	case IsHEIF(detectedFileType):
+		img, err = DecodeHEIF(ctx, tmp.Name())
+		if err != nil {
+			return SavedFile{}, err
+		}
+		saved.Width, saved.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	case detectedFileType == "application/pdf":
+		saved.MediaType = MediaDocument
+		// a document without a preview is still worth keeping, it gets a placeholder instead
+		img, err = PDFPreview(ctx, tmp.Name())
+		if err != nil {
+			log.Printf("no preview for document: %v", err)
+			img = nil
+		}
+	case IsImage(detectedFileType):
+		img, err = DecodeImage(tmp)
+		if err != nil {
+			return SavedFile{}, ErrCorruptImage
+		}
+		saved.Width, saved.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
 
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return SavedFile{}, err
+	}
+	name := randToken(12)
+	// no photo points at the files until this returns, so they are removed again when a later one fails
+	var stored []string
+	fail := func(err error) (SavedFile, error) {
+		for _, key := range stored {
+			if err := store.Delete(context.WithoutCancel(ctx), key); err != nil {
+				log.Printf("error deleting %s: %v", key, err)
+			}
+		}
+		return SavedFile{}, err
+	}
+	saved.Original, err = store.Put(ctx, name+fileEnding, tmp, size, detectedFileType)
 	if err != nil {
-		return "", err
+		return SavedFile{}, err
+	}
+	stored = append(stored, saved.Original.Key)
+	saved.Thumb, saved.Medium = saved.Original, saved.Original
+	if img == nil {
+		return saved, nil
 	}
 
-	defer newFile.Close()
-
-	// Write the file bytes to the new file
-	if _, err := newFile.Write(fileBytes); err != nil {
-		return "", err
+	// pages of text all look alike at the size of the hash, so documents don't get one
+	if saved.MediaType != MediaDocument {
+		saved.PerceptualHash, saved.HasPerceptualHash = DHash(img), true
+	}
+	for _, r := range []struct {
+		rendition Rendition
+		dest      *ObjectInfo
+	}{
+		{ThumbRendition, &saved.Thumb},
+		{MediumRendition, &saved.Medium},
+	} {
+		data, err := r.rendition.Render(img)
+		if err != nil {
+			return fail(err)
+		}
+		info, err := store.Put(ctx, name+r.rendition.Suffix+".jpg", bytes.NewReader(data), int64(len(data)), "image/jpeg")
+		if err != nil {
+			return fail(err)
+		}
+		stored = append(stored, info.Key)
+		*r.dest = info
 	}
-	return newPath, err
+	return saved, nil
 }
 
+// MaxUploadSize is the per file cap for photos and documents
 const MaxUploadSize = 10 << 20 // 10mb
 
+// MaxRequestSize caps all the files of one upload request together
+const MaxRequestSize = 500 << 20 // 500mb, room for a couple of videos
+
 func randToken(len int) string {
 	b := make([]byte, len)
 	if _, err := rand.Read(b); err != nil {
@@ -1,9 +1,14 @@
 package internal
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -49,3 +54,160 @@ func TestGetHeaderApiKey(t *testing.T) {
 		})
 	}
 }
+
+func TestHasApiKeyAuthorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		authHeader string
+		expected   bool
+	}{
+		{"ApiKey scheme", "ApiKey abc123", true},
+		{"Bearer scheme", "Bearer abc123", true},
+		{"scheme is case insensitive", "bearer abc123", true},
+		{"Basic scheme", "Basic dXNlcjpwYXNz", false},
+		{"no header", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			assert.Equal(t, tt.expected, HasApiKeyAuthorization(req))
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// matches encode(sha256('abc'::bytea), 'hex') used by the apikey_hash migration
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", HashToken("abc"))
+
+	key := NewApiKey()
+	assert.Len(t, key, 64)
+	assert.NotEqual(t, key, NewApiKey())
+}
+
+func TestSaveFileReusesDuplicates(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocalStorage(dir)
+	assert.NoError(t, err)
+	data := testPNG(t, 1000, 500)
+
+	stored := map[string]SavedFile{}
+	find := func(hash string) (SavedFile, bool, error) {
+		saved, ok := stored[hash]
+		return saved, ok, nil
+	}
+	first, err := SaveFile(ctx, store, bytes.NewReader(data), LocationStrip, find)
+	assert.NoError(t, err)
+	assert.False(t, first.Duplicate)
+	assert.Len(t, first.ContentHash, 64)
+	assert.True(t, first.HasPerceptualHash)
+	stored[first.ContentHash] = first
+
+	second, err := SaveFile(ctx, store, bytes.NewReader(data), LocationStrip, find)
+	assert.NoError(t, err)
+	assert.True(t, second.Duplicate)
+	assert.Equal(t, first.ContentHash, second.ContentHash)
+	assert.Equal(t, first.Original.Key, second.Original.Key)
+	assert.Equal(t, first.Thumb.Key, second.Thumb.Key)
+
+	// the original and its two renditions, nothing from the second upload
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	other, err := SaveFile(ctx, store, bytes.NewReader(testPNG(t, 1000, 400)), LocationStrip, find)
+	assert.NoError(t, err)
+	assert.False(t, other.Duplicate)
+	assert.NotEqual(t, first.ContentHash, other.ContentHash)
+}
+
+func TestSaveFile(t *testing.T) {
+	tooBig := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, MaxUploadSize)...)
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"image smaller than the sniffing buffer", testPNG(t, 2, 2), nil},
+		{"pdf", []byte("%PDF-1.4\n%%EOF\n"), nil},
+		{"unknown type", []byte("hello"), ErrUnknownFileType},
+		{"empty", nil, ErrUnknownFileType},
+		{"over the size limit", tooBig, ErrFileTooBig},
+		{"damaged image", []byte("\x89PNG\r\n\x1a\nnot really"), ErrCorruptImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewLocalStorage(t.TempDir())
+			assert.NoError(t, err)
+
+			saved, err := SaveFile(context.Background(), store, bytes.NewReader(tt.data), LocationStrip, nil)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				var uploadErr *UploadError
+				assert.ErrorAs(t, err, &uploadErr)
+				assert.NotEmpty(t, uploadErr.Message)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(tt.data)), saved.Original.Size)
+		})
+	}
+}
+
+func TestSaveFileScrubsWhileStreaming(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	data := gpsJPEG(t)
+
+	saved, err := SaveFile(ctx, store, bytes.NewReader(data), LocationStrip, nil)
+	assert.NoError(t, err)
+	// the metadata comes from the upload, the stored original has had its location removed
+	assert.True(t, saved.Metadata.HasLocation)
+	file, _, err := store.Get(ctx, saved.Original.Key)
+	assert.NoError(t, err)
+	stored, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, ScrubLocation(data, LocationStrip), stored)
+}
+
+// failingStorage refuses to store keys ending in suffix
+type failingStorage struct {
+	*LocalStorage
+	suffix string
+}
+
+func (s failingStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	if strings.HasSuffix(key, s.suffix) {
+		return ObjectInfo{}, errors.New("storage unavailable")
+	}
+	return s.LocalStorage.Put(ctx, key, r, size, contentType)
+}
+
+func TestSaveFileRemovesStoredOnError(t *testing.T) {
+	tests := []struct {
+		name   string
+		suffix string
+	}{
+		{"thumb fails", "_thumb.jpg"},
+		{"medium fails", "_medium.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			local, err := NewLocalStorage(dir)
+			assert.NoError(t, err)
+			store := failingStorage{LocalStorage: local, suffix: tt.suffix}
+
+			_, err = SaveFile(context.Background(), store, bytes.NewReader(testPNG(t, 800, 600)), LocationKeep, nil)
+			assert.Error(t, err)
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
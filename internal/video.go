@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Media types of stored photos, videos keep a poster frame as their thumbnail and medium renditions
+// and documents a preview of their first page
+const (
+	MediaImage    = "image"
+	MediaVideo    = "video"
+	MediaDocument = "document"
+)
+
+// MaxVideoUploadSize is the per file cap for videos, they are a lot bigger than photos
+const MaxVideoUploadSize = 200 << 20 // 200mb
+
+// videoTimeout bounds each ffmpeg run on a video
+const videoTimeout = 2 * time.Minute
+
+// ErrVideoUnsupported is returned for videos when ffmpeg isn't installed
+var ErrVideoUnsupported = &UploadError{"VIDEO_NOT_SUPPORTED", "is a video, this server isn't set up for those yet"}
+
+func init() {
+	// the local storage serves files by extension, not every system's mime.types knows these
+	mime.AddExtensionType(".mp4", "video/mp4")
+	mime.AddExtensionType(".mov", "video/quicktime")
+	mime.AddExtensionType(".webm", "video/webm")
+}
+
+// IsVideo reports whether a detected content type is a video that can be probed and played
+func IsVideo(contentType string) bool {
+	switch contentType {
+	case "video/mp4", "video/quicktime", "video/webm":
+		return true
+	}
+	return false
+}
+
+// mp4Brands are the ISO base media brands phones and cameras write, net/http only knows the mp4 ones
+var mp4Brands = map[string]bool{
+	"isom": true, "iso2": true, "iso4": true, "iso5": true, "iso6": true,
+	"mp41": true, "mp42": true, "avc1": true, "M4V ": true,
+}
+
+// sniffContentType is http.DetectContentType plus the HEIF stills, QuickTime and MP4 files it doesn't recognise
+func sniffContentType(head []byte) string {
+	if contentType, ok := sniffHEIF(head); ok {
+		return contentType
+	}
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		brand := string(head[8:12])
+		if brand == "qt  " {
+			return "video/quicktime"
+		}
+		if mp4Brands[brand] {
+			return "video/mp4"
+		}
+	}
+	return http.DetectContentType(head)
+}
+
+// videoFormats are the ffmpeg muxers for the videos that can be uploaded
+var videoFormats = map[string]string{
+	"video/mp4":       "mp4",
+	"video/quicktime": "mov",
+	"video/webm":      "webm",
+}
+
+// videoLocationTags are the metadata keys phones keep the position a video was recorded at in, ffmpeg
+// reads the QuickTime ©xyz atom as location
+var videoLocationTags = []string{"location", "location-eng", "com.apple.quicktime.location.ISO6709"}
+
+// ScrubVideoLocation remuxes the video in f without the location phones record in its metadata, leaving
+// the streams as they are. The position can't be rounded there, so it is dropped for any policy but keep.
+// Only the first video and audio streams are kept, iPhones also record the location in a timed metadata
+// track. f is rewritten with the result, its new size is returned.
+func ScrubVideoLocation(ctx context.Context, f *os.File, contentType string) (int64, error) {
+	out, err := os.CreateTemp("", "video-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, videoTimeout)
+	defer cancel()
+	args := []string{"-v", "error", "-y", "-i", f.Name(), "-c", "copy"}
+	for _, tag := range videoLocationTags {
+		args = append(args, "-metadata", tag+"=")
+	}
+	args = append(args, "-f", videoFormats[contentType], out.Name())
+	err = exec.CommandContext(ctx, "ffmpeg", args...).Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return 0, ErrVideoUnsupported
+	}
+	if err != nil {
+		return 0, ErrCorruptVideo
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	return io.Copy(f, out)
+}
+
+// VideoInfo is what ffprobe finds out about a video, the dimensions are as it is displayed
+type VideoInfo struct {
+	Duration time.Duration
+	Width    int
+	Height   int
+}
+
+// ProbeVideo reads the duration and dimensions of the video file at path
+func ProbeVideo(ctx context.Context, path string) (VideoInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, videoTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height,duration:stream_side_data=rotation:stream_tags=rotate:format=duration",
+		"-of", "json", path,
+	).Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return VideoInfo{}, ErrVideoUnsupported
+	}
+	if err != nil {
+		return VideoInfo{}, ErrCorruptVideo
+	}
+	return parseProbe(out)
+}
+
+type probeOutput struct {
+	Streams []struct {
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		Duration     string `json:"duration"`
+		SideDataList []struct {
+			Rotation int `json:"rotation"`
+		} `json:"side_data_list"`
+		Tags struct {
+			Rotate string `json:"rotate"`
+		} `json:"tags"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+func parseProbe(out []byte) (VideoInfo, error) {
+	var probe probeOutput
+	if err := json.Unmarshal(out, &probe); err != nil || len(probe.Streams) == 0 {
+		return VideoInfo{}, ErrCorruptVideo
+	}
+	stream := probe.Streams[0]
+	info := VideoInfo{Width: stream.Width, Height: stream.Height}
+
+	// phones record portrait video sideways with a rotation for the player to apply
+	rotation, _ := strconv.Atoi(stream.Tags.Rotate)
+	for _, side := range stream.SideDataList {
+		if side.Rotation != 0 {
+			rotation = side.Rotation
+		}
+	}
+	if rotation%180 != 0 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+
+	// webm only has a duration for the whole file
+	duration := probe.Format.Duration
+	if duration == "" {
+		duration = stream.Duration
+	}
+	if seconds, err := strconv.ParseFloat(duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	return info, nil
+}
+
+// VideoPoster picks a representative frame from the start of the video, turned the way it plays
+func VideoPoster(ctx context.Context, path string) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, videoTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ffmpeg", "-v", "error",
+		"-i", path,
+		"-vf", "thumbnail", "-frames:v", "1",
+		"-f", "image2pipe", "-c:v", "png", "pipe:1",
+	).Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, ErrVideoUnsupported
+	}
+	if err != nil || len(out) == 0 {
+		return nil, ErrCorruptVideo
+	}
+	img, err := DecodeImage(bytes.NewReader(out))
+	if err != nil {
+		return nil, ErrCorruptVideo
+	}
+	return img, nil
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"quicktime", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), "video/quicktime"},
+		{"iphone mp4", []byte("\x00\x00\x00\x1cftypisom\x00\x00\x02\x00"), "video/mp4"},
+		{"android mp4", []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00"), "video/mp4"},
+		{"webm", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01webm"), "video/webm"},
+		{"heic isn't a video", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heic"},
+		{"png", []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sniffContentType(tt.head))
+		})
+	}
+}
+
+func TestParseProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    VideoInfo
+		wantErr bool
+	}{
+		{
+			name: "landscape",
+			out:  `{"streams":[{"width":1920,"height":1080,"duration":"12.500000"}],"format":{"duration":"12.512000"}}`,
+			want: VideoInfo{Duration: 12512 * time.Millisecond, Width: 1920, Height: 1080},
+		},
+		{
+			name: "portrait phone video with display matrix",
+			out:  `{"streams":[{"width":1920,"height":1080,"side_data_list":[{"rotation":-90}]}],"format":{"duration":"3.0"}}`,
+			want: VideoInfo{Duration: 3 * time.Second, Width: 1080, Height: 1920},
+		},
+		{
+			name: "rotate tag from older ffmpeg",
+			out:  `{"streams":[{"width":1280,"height":720,"tags":{"rotate":"270"}}],"format":{"duration":"1.0"}}`,
+			want: VideoInfo{Duration: time.Second, Width: 720, Height: 1280},
+		},
+		{
+			name: "upside down keeps its dimensions",
+			out:  `{"streams":[{"width":1280,"height":720,"side_data_list":[{"rotation":180}]}],"format":{}}`,
+			want: VideoInfo{Width: 1280, Height: 720},
+		},
+		{name: "no video stream", out: `{"streams":[],"format":{"duration":"1.0"}}`, wantErr: true},
+		{name: "not json", out: `oops`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseProbe([]byte(tt.out))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, info)
+		})
+	}
+}
+
+func TestSaveFileVideo(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe is not installed")
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "testsrc=duration=2:size=320x240:rate=10",
+		"-pix_fmt", "yuv420p", path).Run()
+	assert.NoError(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	store, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	saved, err := SaveFile(ctx, store, bytes.NewReader(data), LocationStrip, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, MediaVideo, saved.MediaType)
+	assert.Equal(t, 320, saved.Width)
+	assert.Equal(t, 240, saved.Height)
+	assert.InDelta(t, 2*time.Second, saved.Duration, float64(100*time.Millisecond))
+	assert.Equal(t, "video/mp4", saved.Original.ContentType)
+	// the thumbnail is a jpeg of the poster frame, not the video
+	assert.NotEqual(t, saved.Original.Key, saved.Thumb.Key)
+	assert.True(t, saved.HasPerceptualHash)
+}
+
+func TestSaveFileScrubsVideoLocation(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe is not installed")
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "clip.mov")
+	// ffmpeg writes the location as the ©xyz atom phones use
+	err := exec.Command("ffmpeg", "-v", "error", "-f", "lavfi", "-i", "testsrc=duration=1:size=320x240:rate=10",
+		"-pix_fmt", "yuv420p", "-metadata", "location=-36.8477+174.7633/", path).Run()
+	assert.NoError(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		policy       LocationPolicy
+		wantLocation bool
+	}{
+		{name: "keep", policy: LocationKeep, wantLocation: true},
+		{name: "coarsen", policy: LocationCoarsen},
+		{name: "strip", policy: LocationStrip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := NewLocalStorage(dir)
+			assert.NoError(t, err)
+			saved, err := SaveFile(ctx, store, bytes.NewReader(data), tt.policy, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, MediaVideo, saved.MediaType)
+
+			out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format_tags=location",
+				"-of", "default=noprint_wrappers=1", filepath.Join(dir, saved.Original.Key)).Output()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLocation, bytes.Contains(out, []byte("-36.8477+174.7633")), string(out))
+			// the stored original still plays
+			info, err := ProbeVideo(ctx, filepath.Join(dir, saved.Original.Key))
+			assert.NoError(t, err)
+			assert.Equal(t, 320, info.Width)
+		})
+	}
+}
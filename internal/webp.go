@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errBadWebP = errors.New("malformed webp")
+
+// maxWebPMeta is the most that is read of an EXIF or XMP chunk, more than any camera writes
+const maxWebPMeta = 1 << 20
+
+const (
+	webpExifFlag = 0x08
+	webpXMPFlag  = 0x04
+)
+
+// webpFile is a spooled upload, chunks that are dropped shorten it
+type webpFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// webpChunk is where a RIFF chunk starts in the file and how long its data is
+type webpChunk struct {
+	fourCC string
+	offset int64
+	length int64
+}
+
+// end is past the chunk's data and the padding byte that keeps the next chunk at an even offset
+func (c webpChunk) end() int64 {
+	return c.offset + 8 + c.length + c.length&1
+}
+
+// webpChunks lists the chunks of a WebP file in order
+func webpChunks(r io.ReaderAt, size int64) ([]webpChunk, error) {
+	head := make([]byte, 12)
+	if _, err := r.ReadAt(head, 0); err != nil || string(head[:4]) != "RIFF" || string(head[8:]) != "WEBP" {
+		return nil, errBadWebP
+	}
+	var chunks []webpChunk
+	for pos := int64(12); pos+8 <= size; {
+		if _, err := r.ReadAt(head[:8], pos); err != nil {
+			return nil, errBadWebP
+		}
+		c := webpChunk{fourCC: string(head[:4]), offset: pos, length: int64(binary.LittleEndian.Uint32(head[4:8]))}
+		if pos+8+c.length > size {
+			return nil, errBadWebP
+		}
+		chunks = append(chunks, c)
+		pos = c.end()
+	}
+	return chunks, nil
+}
+
+// ScrubWebPLocation applies the policy to the GPS tags in the EXIF chunk of a WebP file, editing it in
+// place. An EXIF chunk it can't make sense of and an XMP chunk mentioning GPS are dropped, moving the
+// chunks after them up. It returns the new size and the metadata from before the location was touched.
+func ScrubWebPLocation(f webpFile, size int64, policy LocationPolicy) (newSize int64, meta PhotoMetadata, ok bool, err error) {
+	chunks, err := webpChunks(f, size)
+	if err != nil {
+		return 0, PhotoMetadata{}, false, err
+	}
+	// from the end, dropping a chunk only moves the ones already done
+	for i := len(chunks) - 1; i >= 0; i-- {
+		c := chunks[i]
+		if c.fourCC != "EXIF" && c.fourCC != "XMP " {
+			continue
+		}
+		if c.length > maxWebPMeta {
+			return 0, PhotoMetadata{}, false, errBadWebP
+		}
+		data := make([]byte, c.length)
+		if _, err := f.ReadAt(data, c.offset+8); err != nil {
+			return 0, PhotoMetadata{}, false, errBadWebP
+		}
+		drop := false
+		if c.fourCC == "EXIF" {
+			// the chunk should be the TIFF alone, some tools keep the Exif\0\0 of a JPEG segment
+			tiff := bytes.TrimPrefix(data, exifHeader)
+			meta, ok = ReadMetadata(bytes.NewReader(tiff))
+			if policy == LocationKeep {
+				continue
+			}
+			if scrubTIFF(tiff, policy) != nil {
+				drop = true
+			} else if _, err := f.WriteAt(data, c.offset+8); err != nil {
+				return 0, PhotoMetadata{}, false, err
+			}
+		} else {
+			drop = policy != LocationKeep && bytes.Contains(data, []byte("GPS"))
+		}
+		if drop {
+			if size, err = dropWebPChunk(f, size, chunks, c); err != nil {
+				return 0, PhotoMetadata{}, false, err
+			}
+		}
+	}
+	return size, meta, ok, nil
+}
+
+// dropWebPChunk removes a chunk from the file, fixing up the RIFF size and the VP8X flag saying it is there
+func dropWebPChunk(f webpFile, size int64, chunks []webpChunk, c webpChunk) (int64, error) {
+	// the padding of the last chunk may be missing
+	end := min(c.end(), size)
+	tail := make([]byte, size-end)
+	if _, err := f.ReadAt(tail, end); err != nil && err != io.EOF {
+		return 0, err
+	}
+	if _, err := f.WriteAt(tail, c.offset); err != nil {
+		return 0, err
+	}
+	size -= end - c.offset
+	if err := f.Truncate(size); err != nil {
+		return 0, err
+	}
+	riffSize := binary.LittleEndian.AppendUint32(nil, uint32(size-8))
+	if _, err := f.WriteAt(riffSize, 4); err != nil {
+		return 0, err
+	}
+	if chunks[0].fourCC == "VP8X" && chunks[0].length > 0 {
+		flags := make([]byte, 1)
+		if _, err := f.ReadAt(flags, chunks[0].offset+8); err != nil {
+			return 0, err
+		}
+		if c.fourCC == "EXIF" {
+			flags[0] &^= webpExifFlag
+		} else {
+			flags[0] &^= webpXMPFlag
+		}
+		if _, err := f.WriteAt(flags, chunks[0].offset+8); err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
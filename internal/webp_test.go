@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func riffChunk(fourCC string, data []byte) []byte {
+	out := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(data)))
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// testWebP builds a WebP of a 1x1 lossless image with the Exif block of gpsJPEG and an XMP packet, exif
+// replaces the Exif block when it is given. Extended files start with a VP8X chunk flagging the metadata,
+// x/image can only decode simple ones.
+func testWebP(t *testing.T, exif []byte, extended bool) []byte {
+	t.Helper()
+	if exif == nil {
+		jpg := gpsJPEG(t)
+		exif = jpg[4+2+6 : 4+int(binary.BigEndian.Uint16(jpg[4:6]))]
+	}
+	lossless, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	assert.NoError(t, err)
+	var vp8x []byte
+	if extended {
+		vp8x = riffChunk("VP8X", []byte{webpExifFlag | webpXMPFlag, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	}
+	body := bytes.Join([][]byte{
+		[]byte("WEBP"),
+		vp8x,
+		lossless[12:],
+		riffChunk("EXIF", exif),
+		riffChunk("XMP ", []byte(`<x:xmpmeta><rdf:Description exif:GPSLatitude="36,50.86S"/></x:xmpmeta>`)),
+	}, nil)
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+}
+
+// writableBytes is a file holding data, for reading WebP chunks back
+func writableBytes(t *testing.T, data []byte) *os.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "photo.webp")
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	assert.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestScrubWebPLocation(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       LocationPolicy
+		exif         []byte
+		wantMeta     bool
+		wantExif     bool
+		wantLocation bool
+		wantLat      float64
+		wantXMP      bool
+	}{
+		{name: "keep", policy: LocationKeep, wantMeta: true, wantExif: true, wantLocation: true, wantLat: -36.8477, wantXMP: true},
+		{name: "coarsen", policy: LocationCoarsen, wantMeta: true, wantExif: true, wantLocation: true, wantLat: -36.85},
+		{name: "strip", policy: LocationStrip, wantMeta: true, wantExif: true},
+		{name: "exif that can't be read is dropped", policy: LocationStrip, exif: []byte("MM\x00\x2a\x00\x00\x00\x08\x00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testWebP(t, tt.exif, true)
+			f := writableBytes(t, data)
+
+			size, meta, ok, err := ScrubWebPLocation(f, int64(len(data)), tt.policy)
+			assert.NoError(t, err)
+			// the metadata is read before the location is touched
+			assert.Equal(t, tt.wantMeta, ok)
+			assert.Equal(t, tt.wantMeta, meta.HasLocation)
+
+			scrubbed, _ := os.ReadFile(f.Name())
+			assert.Equal(t, int64(len(scrubbed)), size)
+			assert.Equal(t, uint32(size-8), binary.LittleEndian.Uint32(scrubbed[4:8]))
+			assert.Equal(t, tt.wantXMP, bytes.Contains(scrubbed, []byte("GPSLatitude")))
+			assert.Equal(t, tt.wantExif, bytes.Contains(scrubbed, []byte("EXIF")))
+			// the flags say which chunks are left
+			flags := scrubbed[20]
+			assert.Equal(t, tt.wantExif, flags&webpExifFlag != 0)
+			assert.Equal(t, tt.wantXMP, flags&webpXMPFlag != 0)
+
+			// scrubbing again reads what was left in the file
+			_, after, _, err := ScrubWebPLocation(f, size, LocationKeep)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLocation, after.HasLocation)
+			if tt.wantLocation {
+				assert.InDelta(t, tt.wantLat, after.Latitude, 0.0001)
+			}
+		})
+	}
+}
+
+func TestScrubWebPLocationRejectsGarbage(t *testing.T) {
+	data := []byte("RIFF\x20\x00\x00\x00WEBPEXIF\xff\x00\x00\x00MM")
+	_, _, _, err := ScrubWebPLocation(writableBytes(t, data), int64(len(data)), LocationStrip)
+	assert.Error(t, err)
+}
+
+func TestSaveFileScrubsWebP(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	assert.NoError(t, err)
+	data := testWebP(t, nil, false)
+
+	saved, err := SaveFile(ctx, store, bytes.NewReader(data), LocationStrip, nil)
+	assert.NoError(t, err)
+	assert.True(t, saved.Metadata.HasLocation)
+	file, info, err := store.Get(ctx, saved.Original.Key)
+	assert.NoError(t, err)
+	stored, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, int64(len(stored)), info.Size)
+	assert.False(t, bytes.Contains(stored, []byte("GPSLatitude")))
+	// the stored original is what is hashed, not the upload
+	sum := sha256.Sum256(stored)
+	assert.Equal(t, hex.EncodeToString(sum[:]), saved.ContentHash)
+	_, after, _, err := ScrubWebPLocation(writableBytes(t, stored), int64(len(stored)), LocationKeep)
+	assert.NoError(t, err)
+	assert.False(t, after.HasLocation)
+	assert.Equal(t, "Apple", after.CameraMake)
+}
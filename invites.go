@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/donseba/go-htmx"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/rowinf/phamily-photos/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// invite links can be used once, within a week of being created
+const inviteTTL = 7 * 24 * time.Hour
+
+const minPasswordLength = 8
+
+// uniqueViolation is the SQLSTATE postgres answers a duplicate key with
+const uniqueViolation = "23505"
+
+var (
+	errInviteInvalid    = errors.New("INVITE_INVALID")
+	errNameRequired     = errors.New("NAME_REQUIRED")
+	errNameTaken        = errors.New("NAME_TAKEN")
+	errPasswordTooShort = errors.New("PASSWORD_TOO_SHORT")
+)
+
+type SignupParams struct {
+	Credentials
+	Invite string `json:"invite"`
+}
+
+type SignupResponse struct {
+	UserResponse
+	FamilyId int64  `json:"family_id"`
+	ApiKey   string `json:"apikey"`
+}
+
+type InviteResponse struct {
+	Url       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// InviteCreate makes a single use signup link for the user's family
+func (a *App) InviteCreate(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	if !user.FamilyID.Valid {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, "no family")
+		return
+	}
+	token := internal.NewInviteToken()
+	invite, err := a.DB.CreateFamilyInvite(r.Context(), database.CreateFamilyInviteParams{
+		TokenHash: internal.HashToken(token),
+		FamilyID:  user.FamilyID.Int64,
+		CreatedBy: user.ID,
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().Add(inviteTTL), Valid: true},
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	link := baseURL(r) + "/signup?invite=" + url.QueryEscape(token)
+
+	if isJSONRequest(r) {
+		internal.RespondWithJSON(w, http.StatusCreated, InviteResponse{
+			Url:       link,
+			ExpiresAt: invite.ExpiresAt.Time.Format(time.DateTime),
+		})
+		return
+	}
+	data := map[string]any{
+		"Link":      link,
+		"ExpiresAt": invite.ExpiresAt.Time,
+	}
+	component := htmx.NewComponent("views/invite.html").SetData(data)
+	component.AddTemplateFunction("formatDate", formatDate)
+	_, err = h.Render(r.Context(), component)
+	if err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+// Signup shows the form an invited person registers with
+func (a *App) Signup(w http.ResponseWriter, r *http.Request) {
+	h := a.htmx.NewHandler(w, r)
+	token := r.URL.Query().Get("invite")
+	invite, err := a.DB.GetFamilyInvite(r.Context(), internal.HashToken(token))
+	errCode := r.URL.Query().Get("error")
+	data := map[string]any{
+		"Invite":        token,
+		"InvalidInvite": err != nil || errCode == strings.ToLower(errInviteInvalid.Error()),
+		"FamilyName":    invite.FamilyName,
+		"Error":         errCode,
+	}
+	component := htmx.NewComponent("views/signup.html").SetData(data)
+	page := mainContentWithNavbar("Phamily Photos Signup", navbarWithoutUser())
+	page.With(component, "Content")
+
+	_, err = h.Render(r.Context(), page)
+	if err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+// SignupCreate registers a user with an invite, from the signup form or as JSON on POST /v1/users
+func (a *App) SignupCreate(w http.ResponseWriter, r *http.Request) {
+	body := SignupParams{}
+	isJSON := isJSONRequest(r)
+	if isJSON {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			internal.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Error parsing form data", http.StatusBadRequest)
+			return
+		}
+		body.Name = r.FormValue("username")
+		body.Password = r.FormValue("password")
+		body.Invite = r.FormValue("invite")
+	}
+
+	user, err := a.createInvitedUser(r.Context(), body)
+	if err != nil {
+		status := signupErrorStatus(err)
+		if isJSON {
+			internal.RespondWithError(w, status, err.Error())
+			return
+		}
+		if status == http.StatusInternalServerError {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		query := url.Values{"invite": {body.Invite}, "error": {strings.ToLower(err.Error())}}
+		http.Redirect(w, r, "/signup?"+query.Encode(), http.StatusSeeOther)
+		return
+	}
+
+	if !isJSON {
+		if err := a.saveSessionUser(w, r, user.ID); err != nil {
+			http.Error(w, "Unable to save session", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/photos", http.StatusSeeOther)
+		return
+	}
+
+	// JSON clients authenticate with an api key rather than the session cookie
+	key := internal.NewApiKey()
+	err = a.DB.UpdateUserApiKey(r.Context(), database.UpdateUserApiKeyParams{
+		ID:         user.ID,
+		ApikeyHash: pgtype.Text{String: internal.HashToken(key), Valid: true},
+	})
+	if err != nil {
+		internal.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	internal.RespondWithJSON(w, http.StatusCreated, SignupResponse{
+		UserResponse: UserResponse{
+			BaseParams: BaseParams{
+				Id:        uuid.MustParse(user.ID),
+				CreatedAt: user.CreatedAt.Time.Format(time.DateTime),
+				UpdatedAt: user.UpdatedAt.Time.Format(time.DateTime),
+			},
+			Name: user.Name,
+		},
+		FamilyId: user.FamilyID.Int64,
+		ApiKey:   key,
+	})
+}
+
+// createInvitedUser creates a user in the inviting family and uses up the invite in one transaction
+func (a *App) createInvitedUser(ctx context.Context, body SignupParams) (database.User, error) {
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		return database.User{}, errNameRequired
+	}
+	if len(body.Password) < minPasswordLength {
+		return database.User{}, errPasswordTooShort
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return database.User{}, err
+	}
+	tokenHash := internal.HashToken(body.Invite)
+
+	var user database.User
+	err = a.withTx(ctx, func(txq *database.Queries) error {
+		invite, err := txq.GetFamilyInvite(ctx, tokenHash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errInviteInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := txq.GetUserByName(ctx, body.Name); err == nil {
+			return errNameTaken
+		}
+		user, err = txq.CreateUser(ctx, database.CreateUserParams{
+			ID:       uuid.NewString(),
+			Name:     body.Name,
+			Password: string(hashedPassword),
+			FamilyID: pgtype.Int8{Int64: invite.FamilyID, Valid: true},
+		})
+		// a signup racing us for the name is only caught by the constraint
+		if isUniqueViolation(err, "users_name_key") {
+			return errNameTaken
+		}
+		if err != nil {
+			return err
+		}
+		return joinInvitedFamily(ctx, txq, tokenHash, user.ID, invite.FamilyID)
+	})
+	return user, err
+}
+
+// InviteAccept adds an existing user to the inviting family and switches them to it
+func (a *App) InviteAccept(w http.ResponseWriter, r *http.Request, user database.User) {
+	var token string
+	isJSON := isJSONRequest(r)
+	if isJSON {
+		body := SignupParams{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			internal.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		token = body.Invite
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Error parsing form data", http.StatusBadRequest)
+			return
+		}
+		token = r.FormValue("invite")
+	}
+	tokenHash := internal.HashToken(token)
+
+	err := a.withTx(r.Context(), func(txq *database.Queries) error {
+		invite, err := txq.GetFamilyInvite(r.Context(), tokenHash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errInviteInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if err := joinInvitedFamily(r.Context(), txq, tokenHash, user.ID, invite.FamilyID); err != nil {
+			return err
+		}
+		return txq.SetUserFamily(r.Context(), database.SetUserFamilyParams{
+			ID:       user.ID,
+			FamilyID: pgtype.Int8{Int64: invite.FamilyID, Valid: true},
+		})
+	})
+	if err != nil {
+		status := signupErrorStatus(err)
+		if isJSON {
+			internal.RespondWithError(w, status, err.Error())
+			return
+		}
+		if status == http.StatusInternalServerError {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		// the signup page says the invite can't be used any more
+		query := url.Values{"invite": {token}, "error": {strings.ToLower(err.Error())}}
+		http.Redirect(w, r, "/signup?"+query.Encode(), http.StatusSeeOther)
+		return
+	}
+	if !isJSON {
+		http.Redirect(w, r, "/photos", http.StatusSeeOther)
+		return
+	}
+	a.respondFamilyChanged(w, r, user, http.StatusOK)
+}
+
+// joinInvitedFamily makes the user a member of the family and uses up the invite
+func joinInvitedFamily(ctx context.Context, txq *database.Queries, tokenHash, userID string, familyID int64) error {
+	err := txq.CreateFamilyMembership(ctx, database.CreateFamilyMembershipParams{
+		UserID:   userID,
+		FamilyID: familyID,
+		Role:     roleMember,
+	})
+	if err != nil {
+		return err
+	}
+	// another signup may have raced us to the same invite
+	used, err := txq.UseFamilyInvite(ctx, database.UseFamilyInviteParams{
+		TokenHash: tokenHash,
+		UsedBy:    pgtype.Text{String: userID, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return errInviteInvalid
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is postgres refusing a duplicate for the named constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == constraint
+}
+
+func signupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInviteInvalid):
+		return http.StatusGone
+	case errors.Is(err, errNameTaken):
+		return http.StatusConflict
+	case errors.Is(err, errNameRequired), errors.Is(err, errPasswordTooShort):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// baseURL is the scheme and host the request was made to, honouring the Cloud Run proxy
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
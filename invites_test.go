@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "taken name", err: &pgconn.PgError{Code: uniqueViolation, ConstraintName: "users_name_key"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("create user: %w", &pgconn.PgError{Code: uniqueViolation, ConstraintName: "users_name_key"}), want: true},
+		{name: "another constraint", err: &pgconn.PgError{Code: uniqueViolation, ConstraintName: "users_pkey"}},
+		{name: "another error", err: &pgconn.PgError{Code: "23503", ConstraintName: "users_name_key"}},
+		{name: "not postgres", err: errors.New("connection reset")},
+		{name: "no error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isUniqueViolation(tt.err, "users_name_key"))
+		})
+	}
+}
@@ -3,12 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
+	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +24,7 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/rowinf/phamily-photos/internal"
 	"github.com/rowinf/phamily-photos/internal/database"
@@ -73,9 +79,13 @@ type (
 	App struct {
 		htmx         *htmx.HTMX
 		DB           *database.Queries
-		DBConn       *pgx.Conn
+		DBPool       *pgxpool.Pool
 		Router       chi.Router
 		SessionStore sessions.Store
+		Storage      internal.Storage
+		Partials     *internal.PartialUploads
+		// FamilyQuota is how many bytes of originals each family can store, 0 for no limit
+		FamilyQuota int64
 	}
 )
 
@@ -86,20 +96,36 @@ func main() {
 		log.Printf("warning: assuming default configuration. .env unreadable: %v", err)
 	}
 	port := os.Getenv("PORT")
-	conn, err := pgx.Connect(context.Background(), os.Getenv("GOOSE_DBSTRING"))
+	pool, err := internal.NewPool(context.Background())
+	if err != nil {
+		log.Fatalf("unable to connect to database: %v", err)
+	}
+	defer pool.Close()
 	store := sessions.NewCookieStore([]byte(os.Getenv("SESSION_KEY")))
+	storage, err := internal.NewStorageFromEnv()
 	if err != nil {
 		panic(err)
 	}
+	var quota int64
+	if mb := os.Getenv("FAMILY_STORAGE_QUOTA_MB"); mb != "" {
+		quota, err = strconv.ParseInt(mb, 10, 64)
+		if err != nil || quota < 0 {
+			log.Fatalf("FAMILY_STORAGE_QUOTA_MB must be a number of megabytes: %q", mb)
+		}
+		quota <<= 20
+	}
 
 	mux := chi.NewRouter()
 	// new app with htmx instance
 	app := &App{
 		htmx:         htmx.New(),
-		DB:           database.New(conn),
-		DBConn:       conn,
+		DB:           database.New(pool),
+		DBPool:       pool,
 		Router:       mux,
 		SessionStore: store,
+		Storage:      storage,
+		Partials:     internal.NewPartialUploads(storage),
+		FamilyQuota:  quota,
 	}
 	logger := httplog.NewLogger("httplog-example", httplog.Options{
 		// JSON:             true,
@@ -114,22 +140,73 @@ func main() {
 
 	htmx.UseTemplateCache = false
 	workDir, _ := os.Getwd()
-	filesDir := http.Dir(filepath.Join(workDir, "assets", "uploads"))
 	cssDir := http.Dir(filepath.Join(workDir, "assets", "static"))
 
 	mux.Use(httplog.RequestLogger(logger))
 	mux.Get("/", app.Home)
+	mux.Get("/healthz", app.Healthz)
 	mux.Get("/login", app.Login)
 	mux.Get("/logout", app.Logout)
 	mux.Get("/photos", app.middlewareAuth(app.GetPhotosIndex))
 	mux.Get("/photos/new", app.middlewareAuth(app.GetPhotoNew))
+	mux.Get("/photos/duplicates", app.middlewareAuth(app.PhotoDuplicates))
+	mux.Get("/trash", app.middlewareAuth(app.TrashGet))
+	mux.Post("/photos/{photoID}/restore", app.middlewareAuth(app.PhotoRestore))
+	mux.Post("/posts/{postID}/restore", app.middlewareAuth(app.PostRestore))
 	mux.Get("/family", app.middlewareAuth(app.FamiliesGet))
 	mux.Delete("/photos/{photoID}", app.middlewareAuth(app.DeletePhoto))
 	mux.Get("/photos/{photoID}", app.middlewareAuth(app.GetPhoto))
+	mux.Post("/photos/{photoID}/merge", app.middlewareAuth(app.PhotoMerge))
+	mux.Post("/photos/{photoID}/reactions", app.middlewareAuth(app.PhotoReactionToggle))
+	mux.Get("/media/{photoID}", app.middlewareAuth(app.MediaGet))
 	mux.Post("/photos", app.middlewareAuth(app.PhotoCreate))
+	mux.Get("/posts/{postID}", app.middlewareAuth(app.PostGet))
+	mux.Get("/posts/{postID}/edit", app.middlewareAuth(app.PostEdit))
+	mux.Put("/posts/{postID}", app.middlewareAuth(app.PostUpdate))
+	mux.Patch("/posts/{postID}", app.middlewareAuth(app.PostUpdate))
+	mux.Delete("/posts/{postID}", app.middlewareAuth(app.PostDelete))
+	mux.Post("/posts/{postID}/photos", app.middlewareAuth(app.PostPhotosAdd))
+	mux.Post("/posts/{postID}/photos/{photoID}/move", app.middlewareAuth(app.PostPhotoMove))
+	mux.Post("/posts/{postID}/reactions", app.middlewareAuth(app.PostReactionToggle))
+	mux.Get("/posts/{postID}/comments", app.middlewareAuth(app.CommentsGet))
+	mux.Post("/posts/{postID}/comments", app.middlewareAuth(app.CommentCreate))
+	mux.Get("/posts/{postID}/comments/{commentID}", app.middlewareAuth(app.CommentGet))
+	mux.Get("/posts/{postID}/comments/{commentID}/edit", app.middlewareAuth(app.CommentEdit))
+	mux.Put("/posts/{postID}/comments/{commentID}", app.middlewareAuth(app.CommentUpdate))
+	mux.Delete("/posts/{postID}/comments/{commentID}", app.middlewareAuth(app.CommentDelete))
 	mux.Get("/v1/users", app.middlewareAuth(app.usersGet))
+	mux.Post("/v1/users/apikey", app.middlewareAuth(app.ApiKeyRotate))
+	mux.Delete("/v1/users/apikey", app.middlewareAuth(app.ApiKeyRevoke))
 	mux.Post("/session/new", app.sessionNew)
-	FileServer(mux, "/assets/uploads", filesDir)
+	mux.Get("/signup", app.Signup)
+	mux.Post("/signup", app.SignupCreate)
+	mux.Post("/v1/users", app.SignupCreate)
+	mux.Post("/family/invites", app.middlewareAuth(app.InviteCreate))
+	mux.Post("/invites/accept", app.middlewareAuth(app.InviteAccept))
+	mux.Put("/family/selected", app.middlewareAuth(app.FamilySelect))
+	mux.Put("/family", app.middlewareAuth(app.FamilyUpdate))
+	mux.Put("/family/admin", app.middlewareAuth(app.FamilyAdminUpdate))
+	mux.Delete("/family/members/{userID}", app.middlewareAuth(app.FamilyMemberDelete))
+	mux.Get("/families/new", app.middlewareAuth(app.FamilyNew))
+	mux.Post("/families", app.middlewareAuth(app.FamilyCreate))
+	mux.Get("/v1/family", app.middlewareAuth(app.FamiliesGet))
+	mux.Put("/v1/family", app.middlewareAuth(app.FamilyUpdate))
+	mux.Put("/v1/family/admin", app.middlewareAuth(app.FamilyAdminUpdate))
+	mux.Delete("/v1/family/members/{userID}", app.middlewareAuth(app.FamilyMemberDelete))
+	mux.Post("/v1/families", app.middlewareAuth(app.FamilyCreate))
+	mux.Get("/v1/families", app.middlewareAuth(app.FamiliesList))
+	mux.Put("/v1/posts/{postID}", app.middlewareAuth(app.PostUpdate))
+	mux.Patch("/v1/posts/{postID}", app.middlewareAuth(app.PostUpdate))
+	mux.Delete("/v1/posts/{postID}", app.middlewareAuth(app.PostDelete))
+	mux.Post("/v1/posts/{postID}/photos", app.middlewareAuth(app.PostPhotosAdd))
+	mux.Post("/v1/posts/{postID}/photos/{photoID}/move", app.middlewareAuth(app.PostPhotoMove))
+	mux.Put("/v1/family/selected", app.middlewareAuth(app.FamilySelect))
+	mux.Post("/v1/invites/accept", app.middlewareAuth(app.InviteAccept))
+	mux.Options("/v1/uploads", app.UploadOptions)
+	mux.Post("/v1/uploads", app.middlewareAuth(app.UploadCreate))
+	mux.Head("/v1/uploads/{uploadID}", app.middlewareAuth(app.UploadHead))
+	mux.Patch("/v1/uploads/{uploadID}", app.middlewareAuth(app.UploadPatch))
+	mux.Delete("/v1/uploads/{uploadID}", app.middlewareAuth(app.UploadDelete))
 	FileServer(mux, "/static", cssDir)
 	srv := &http.Server{
 		Addr:         ":" + port,
@@ -138,10 +215,26 @@ func main() {
 		WriteTimeout: 10 * time.Second, // set a custom write timeout
 	}
 
+	go app.purgeTrash(context.Background())
 	err = srv.ListenAndServe()
 	log.Fatal(err)
 }
 
+// withTx runs fn inside a transaction, committing if it returns nil and rolling back otherwise
+func (a *App) withTx(ctx context.Context, fn func(*database.Queries) error) error {
+	return pgx.BeginFunc(ctx, a.DBPool, func(tx pgx.Tx) error {
+		return fn(a.DB.WithTx(tx))
+	})
+}
+
+func (a *App) Healthz(w http.ResponseWriter, r *http.Request) {
+	if err := a.DBPool.Ping(r.Context()); err != nil {
+		internal.RespondWithError(w, http.StatusServiceUnavailable, "database unavailable")
+		return
+	}
+	internal.RespondWithOk(w)
+}
+
 func (a *App) Home(w http.ResponseWriter, r *http.Request) {
 	h := a.htmx.NewHandler(w, r)
 
@@ -165,7 +258,7 @@ func (a *App) GetPhotoNew(w http.ResponseWriter, r *http.Request, user database.
 		"Title": "Phamily Photos Photo",
 	}
 	component := htmx.NewComponent("views/photo-new.html")
-	page := htmx.NewComponent("views/index.html").SetData(data).With(navbarWithUser(user), "Navbar")
+	page := htmx.NewComponent("views/index.html").SetData(data).With(a.navbarWithUser(r.Context(), user), "Navbar")
 	page.With(component, "Content")
 
 	_, err := h.Render(r.Context(), page)
@@ -179,41 +272,167 @@ type Photo struct {
 	PhotoName     string `json:"photo_name"`
 	PhotoUrl      string `json:"photo_url"`
 	PhotoThumbUrl string `json:"photo_thumb_url"`
+	MediaType     string `json:"media_type"`
+}
+
+const postsPageSize = 10
+
+// postsPage loads a page of the family feed, starting after the cursor when there is one.
+// next is empty on the last page.
+func (a *App) postsPage(ctx context.Context, user database.User, before string) (posts []database.GetPostsByUserFamilyAggregatedRow, next string, err error) {
+	params := database.GetPostsByUserFamilyAggregatedParams{
+		FamilyID: user.FamilyID.Int64,
+		Limit:    postsPageSize + 1,
+		UserID:   user.ID,
+	}
+	if before != "" {
+		cursor, err := internal.ParseCursor(before)
+		if err != nil {
+			return nil, "", err
+		}
+		params.BeforeCreatedAt = pgtype.Timestamp{Time: cursor.CreatedAt, Valid: true}
+		params.BeforeID = pgtype.Int8{Int64: cursor.ID, Valid: true}
+	}
+	posts, err = a.DB.GetPostsByUserFamilyAggregated(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+	// the extra row only tells us there is another page
+	if len(posts) > postsPageSize {
+		posts = posts[:postsPageSize]
+		last := posts[len(posts)-1]
+		next = internal.Cursor{CreatedAt: last.PostCreatedAt.Time, ID: last.PostID}.String()
+	}
+	return posts, next, nil
 }
 
 func (a *App) GetPhotosIndex(w http.ResponseWriter, r *http.Request, user database.User) {
 	h := a.htmx.NewHandler(w, r)
-	posts, _ := a.DB.GetPostsByUserFamilyAggregated(r.Context(), database.GetPostsByUserFamilyAggregatedParams{
-		FamilyID: user.FamilyID,
-		Limit:    10,
-	})
+	before := r.URL.Query().Get("before")
+	posts, next, err := a.postsPage(r.Context(), user, before)
+	if errors.Is(err, internal.ErrInvalidCursor) {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	data := map[string]any{
-		"Title": "Posts Title",
-		"Posts": posts,
+		"Title":      "Posts Title",
+		"Posts":      posts,
+		"NextCursor": next,
 	}
-	component := htmx.NewComponent("views/posts-index.html", "views/photo.html").SetData(data)
+	// infinite scroll asks for the next page with htmx and appends it in place of the loader
+	if before != "" && h.IsHxRequest() && !h.IsHxBoosted() {
+		component := htmx.NewComponent("views/posts-page.html", "views/post.html", "views/reactions.html").SetData(data)
+		if _, err := h.Render(r.Context(), component); err != nil {
+			fmt.Printf("error rendering page: %v", err.Error())
+		}
+		return
+	}
+	component := htmx.NewComponent("views/posts-index.html", "views/posts-page.html", "views/post.html", "views/reactions.html").SetData(data)
 	component.AddTemplateFunction("formatDate", formatDate)
-	page := mainContentWithNavbar("Phamily Photos", navbarWithUser(user))
+	page := mainContentWithNavbar("Phamily Photos", a.navbarWithUser(r.Context(), user))
 	page.With(component, "Content")
-	_, err := h.Render(r.Context(), page)
+	_, err = h.Render(r.Context(), page)
 	if err != nil {
 		fmt.Printf("error rendering page: %v", err.Error())
 	}
 }
 
 func (a *App) DeletePhoto(w http.ResponseWriter, r *http.Request, user database.User) {
-	err := a.DB.DeletePhoto(r.Context(), database.DeletePhotoParams{
+	photo, err := a.DB.GetPhoto(r.Context(), database.GetPhotoParams{
 		ID:     r.PathValue("photoID"),
 		UserID: user.ID,
 	})
-	if err != nil {
+	if err != nil || !photo.IsMyPhoto {
 		internal.RespondWithError(w, http.StatusNotFound, "not found")
 		return
 	}
+	// the files stay until the trash is purged, so the photo can be restored
+	rows, err := a.DB.TrashPhoto(r.Context(), database.TrashPhotoParams{
+		ID:     photo.ID,
+		UserID: user.ID,
+	})
+	if err != nil || rows == 0 {
+		internal.RespondWithError(w, http.StatusNotFound, "not found")
+		return
+	}
+	h := a.htmx.NewHandler(w, r)
+	// lets lists showing the photo elsewhere on the page, like the duplicates review, reload
+	h.Trigger(photoRemovedEvent)
+	h.TriggerInfo("The photo was moved to the trash, it can be restored for 30 days")
 	internal.RespondWithOk(w)
 }
 
+// deleteUnusedBlobs removes the files of a deleted photo. Duplicate uploads share files,
+// they are only removed along with the last photo using them.
+func (a *App) deleteUnusedBlobs(ctx context.Context, url, thumbUrl, mediumUrl string) {
+	count, err := a.DB.CountPhotosByUrl(ctx, url)
+	if err != nil {
+		log.Printf("error counting photos using %s: %v", url, err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	for _, url := range []string{url, thumbUrl, mediumUrl} {
+		if err := a.Storage.Delete(ctx, internal.KeyFromURL(url)); err != nil {
+			log.Printf("error deleting %s from storage: %v", url, err)
+		}
+	}
+}
+
+// MediaGet streams a photo, or one of its renditions, to members of the family it was posted in
+func (a *App) MediaGet(w http.ResponseWriter, r *http.Request, user database.User) {
+	photo, err := a.DB.GetFamilyMedia(r.Context(), database.GetFamilyMediaParams{
+		ID:       r.PathValue("photoID"),
+		FamilyID: user.FamilyID.Int64,
+		UserID:   user.ID,
+	})
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	url := photo.Url
+	switch r.URL.Query().Get("size") {
+	case "thumb":
+		url = photo.ThumbUrl
+	case "medium":
+		url = photo.MediumUrl
+	}
+	key := internal.KeyFromURL(url)
+	file, info, err := a.Storage.Get(r.Context(), key)
+	if errors.Is(err, internal.ErrObjectNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	if photo.MediaType == internal.MediaVideo && url == photo.Url {
+		// a video plays for longer than the server's write timeout allows
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(uploadTimeout))
+	}
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if info.ETag != "" {
+		w.Header().Set("ETag", `"`+strings.Trim(info.ETag, `"`)+`"`)
+	}
+	if r.URL.Query().Get("download") != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+	}
+	// keys never change content, but the response depends on who is asking
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	// ServeContent answers Range and If-None-Match requests for us
+	http.ServeContent(w, r, key, info.ModTime, file)
+}
+
 func (a *App) GetPhoto(w http.ResponseWriter, r *http.Request, user database.User) {
 	h := a.htmx.NewHandler(w, r)
 	photo, err := a.DB.GetPhoto(r.Context(), database.GetPhotoParams{
@@ -224,12 +443,17 @@ func (a *App) GetPhoto(w http.ResponseWriter, r *http.Request, user database.Use
 		internal.RespondWithError(w, http.StatusNotFound, "not found")
 		return
 	}
+	// photos without EXIF have no metadata row
+	metadata, err := a.DB.GetPhotoMetadata(r.Context(), photo.ID)
 	data := map[string]any{
-		"Photo":      photo,
-		"formatDate": formatDate,
+		"Photo":    photo,
+		"Metadata": metadata,
+		"HasMeta":  err == nil,
 	}
-	component := htmx.NewComponent("views/photo.html").SetData(data)
-	page := mainContentWithNavbar("Phamily Photos Photo", navbarWithUser(user))
+	component := htmx.NewComponent("views/photo.html", "views/reactions.html").SetData(data)
+	component.AddTemplateFunction("formatDate", formatDate)
+	component.AddTemplateFunction("formatDuration", formatDuration)
+	page := mainContentWithNavbar("Phamily Photos Photo", a.navbarWithUser(r.Context(), user))
 	page.With(component, "Content")
 
 	_, err = h.Render(r.Context(), page)
@@ -283,18 +507,7 @@ func (a *App) sessionNew(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login?error=invalid_credentials", http.StatusSeeOther)
 		return
 	}
-	session, err := a.SessionStore.Get(r, "session_id")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Store API key and set session expiration (e.g., 60 minutes)
-	session.Values["UserID"] = user.ID
-
-	// Save the session
-	err = session.Save(r, w)
-	if err != nil {
+	if err := a.saveSessionUser(w, r, user.ID); err != nil {
 		fmt.Println(err.Error())
 		http.Error(w, "Unable to save session", http.StatusInternalServerError)
 		return
@@ -313,127 +526,344 @@ func (a *App) sessionNew(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// saveSessionUser logs the user in by storing their id in the session cookie
+func (a *App) saveSessionUser(w http.ResponseWriter, r *http.Request, userID string) error {
+	session, err := a.SessionStore.Get(r, "session_id")
+	if err != nil {
+		return err
+	}
+	session.Values["UserID"] = userID
+	return session.Save(r, w)
+}
+
 func (a *App) middlewareAuth(handler authedHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		contentType := r.Header.Get("Content-Type")
-		var user database.User
-		var uerr error
-		if contentType == "" || contentType == "application/x-www-form-urlencoded" || contentType[:19] == "multipart/form-data" {
-			session, err := a.SessionStore.Get(r, "session_id")
+		if internal.HasApiKeyAuthorization(r) {
+			key, err := internal.GetHeaderApiKey(w, r)
 			if err != nil {
-				http.Redirect(w, r, "/login?error=redirected", http.StatusSeeOther)
+				internal.RespondWithError(w, http.StatusUnauthorized, err.Error())
 				return
 			}
-
-			err = session.Save(r, w)
+			user, err := a.DB.GetUserByApiKey(r.Context(), pgtype.Text{String: internal.HashToken(key), Valid: true})
 			if err != nil {
-				http.Error(w, "unable to save session", http.StatusInternalServerError)
+				internal.RespondWithError(w, http.StatusUnauthorized, "invalid api key")
 				return
 			}
-
-			userID, ok := session.Values["UserID"].(string)
-			if !ok || userID == "" {
-				http.Error(w, "session invalid", http.StatusUnauthorized)
+			user, err = a.withSelectedFamily(r.Context(), user)
+			if err != nil {
+				internal.RespondWithError(w, http.StatusInternalServerError, err.Error())
 				return
 			}
+			handler(w, r, user)
+			return
+		}
 
-			user, uerr = a.DB.GetUserByID(r.Context(), userID)
-			if uerr != nil {
-				http.Redirect(w, r, "/login?error=redirected", http.StatusSeeOther)
+		// JSON clients get a 401 rather than being sent to the login page
+		isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+		session, err := a.SessionStore.Get(r, "session_id")
+		if err != nil {
+			if isJSON {
+				internal.RespondWithError(w, http.StatusUnauthorized, "session invalid")
 				return
 			}
+			http.Redirect(w, r, "/login?error=redirected", http.StatusSeeOther)
+			return
+		}
+
+		err = session.Save(r, w)
+		if err != nil {
+			http.Error(w, "unable to save session", http.StatusInternalServerError)
+			return
 		}
-		if uerr != nil {
+
+		userID, ok := session.Values["UserID"].(string)
+		if !ok || userID == "" {
+			if isJSON {
+				internal.RespondWithError(w, http.StatusUnauthorized, "session invalid")
+				return
+			}
 			http.Error(w, "session invalid", http.StatusUnauthorized)
 			return
 		}
+
+		user, err := a.DB.GetUserByID(r.Context(), userID)
+		if err != nil {
+			if isJSON {
+				internal.RespondWithError(w, http.StatusUnauthorized, "session invalid")
+				return
+			}
+			http.Redirect(w, r, "/login?error=redirected", http.StatusSeeOther)
+			return
+		}
+		user, err = a.withSelectedFamily(r.Context(), user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		handler(w, r, user)
 	}
 }
 
+type ApiKeyResponse struct {
+	ApiKey string `json:"apikey"`
+}
+
+// ApiKeyRotate issues a new api key, replacing any previous one. The key is only ever shown here.
+func (a *App) ApiKeyRotate(w http.ResponseWriter, r *http.Request, user database.User) {
+	key := internal.NewApiKey()
+	err := a.DB.UpdateUserApiKey(r.Context(), database.UpdateUserApiKeyParams{
+		ID:         user.ID,
+		ApikeyHash: pgtype.Text{String: internal.HashToken(key), Valid: true},
+	})
+	if err != nil {
+		internal.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	internal.RespondWithJSON(w, http.StatusCreated, ApiKeyResponse{ApiKey: key})
+}
+
+// ApiKeyRevoke removes the user's api key, after which only the session cookie authenticates them
+func (a *App) ApiKeyRevoke(w http.ResponseWriter, r *http.Request, user database.User) {
+	err := a.DB.UpdateUserApiKey(r.Context(), database.UpdateUserApiKeyParams{
+		ID: user.ID,
+	})
+	if err != nil {
+		internal.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	internal.RespondWithOk(w)
+}
+
+// uploadTimeout replaces the server's read and write timeouts while an upload streams in
+const uploadTimeout = 10 * time.Minute
+
+var (
+	errUploadTooBig = &internal.UploadError{Code: "UPLOAD_TOO_BIG", Message: "The upload is too big, all the files together can be up to 500MB."}
+	errNoFiles      = &internal.UploadError{Code: "NO_FILES", Message: "Choose at least one file to post."}
+)
+
+// uploadResult is what happened to one file of an upload form, Err is why it wasn't saved
+type uploadResult struct {
+	Filename string
+	Saved    internal.SavedFile
+	Err      *internal.UploadError
+}
+
+// receiveUploads streams the parts of an upload form, files go straight into storage as they arrive.
+// A file that is refused doesn't stop the others, it gets a result with the reason. Errors are for the
+// whole form, files saved before one are in the results so they can be removed.
+func (a *App) receiveUploads(r *http.Request, family database.Family) (caption string, results []uploadResult, err error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return "", nil, err
+	}
+	// a file repeated within the upload isn't in the database yet
+	inUpload := map[string]internal.SavedFile{}
+	inFamily := a.findFamilyUpload(r.Context(), a.DB, family.ID)
+	find := func(hash string) (internal.SavedFile, bool, error) {
+		if saved, ok := inUpload[hash]; ok {
+			return saved, true, nil
+		}
+		return inFamily(hash)
+	}
+	quota, err := a.newQuota(r.Context(), a.DB, family.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return caption, results, nil
+		}
+		if err != nil {
+			return caption, results, err
+		}
+		switch part.FormName() {
+		case "description":
+			b, err := io.ReadAll(io.LimitReader(part, maxCaptionLength+1))
+			if err != nil {
+				return caption, results, err
+			}
+			caption = strings.TrimSpace(string(b))
+		case "photo":
+			// an empty file input still sends a part
+			if part.FileName() == "" {
+				break
+			}
+			result := uploadResult{Filename: part.FileName()}
+			result.Saved, err = internal.SaveFile(r.Context(), a.Storage, part, internal.LocationPolicy(family.LocationExif), find)
+			if err == nil {
+				err = quota.take(result.Saved)
+				if err != nil {
+					a.discardSaved(r.Context(), result.Saved)
+				}
+			}
+			if !errors.As(err, &result.Err) && err != nil {
+				return caption, results, err
+			}
+			if result.Err == nil {
+				inUpload[result.Saved.ContentHash] = result.Saved
+			}
+			results = append(results, result)
+		}
+		part.Close()
+	}
+}
+
+// uploadFormError is what is wrong with an upload form as a whole, given what receiveUploads made of it.
+// A form without any files has nothing to post, even with a caption.
+func uploadFormError(caption string, results []uploadResult, err error) error {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return errUploadTooBig
+	case err != nil:
+		return err
+	case len(results) == 0:
+		return errNoFiles
+	case len(caption) > maxCaptionLength:
+		return errCaptionTooLong
+	}
+	return nil
+}
+
+// quota keeps track of a family's storage while files are added to it
+type quota struct {
+	limit, used int64
+}
+
+// newQuota looks up how much a family has stored, the quota has no limit when the app has none
+func (a *App) newQuota(ctx context.Context, q *database.Queries, familyID int64) (*quota, error) {
+	if a.FamilyQuota == 0 {
+		return &quota{}, nil
+	}
+	used, err := q.GetFamilyStorageUsed(ctx, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return &quota{limit: a.FamilyQuota, used: used}, nil
+}
+
+// fits reports whether there is room for size more bytes
+func (q *quota) fits(size int64) bool {
+	return q.limit == 0 || q.used+size <= q.limit
+}
+
+// take counts a saved file against the quota, a duplicate takes no more room
+func (q *quota) take(saved internal.SavedFile) error {
+	if saved.Duplicate {
+		return nil
+	}
+	if !q.fits(saved.Original.Size) {
+		return internal.ErrQuotaExceeded
+	}
+	q.used += saved.Original.Size
+	return nil
+}
+
 func (a *App) PhotoCreate(w http.ResponseWriter, r *http.Request, user database.User) {
 	h := a.htmx.NewHandler(w, r)
 	var form htmx.RenderableComponent
-	if err := r.ParseMultipartForm(internal.MaxUploadSize); err != nil {
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
-		return
-	}
-	files := r.MultipartForm.File["photo"]
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(uploadTimeout))
+	rc.SetWriteDeadline(time.Now().Add(uploadTimeout))
+	r.Body = http.MaxBytesReader(w, r.Body, internal.MaxRequestSize)
 
 	pageData := map[string]any{
 		"Title": "Phamily Photos Photo",
 	}
-	tx, err := a.DBConn.Begin(r.Context())
+	// someone removed from their last family has nowhere to post, browsers are offered to start one
+	if !user.FamilyID.Valid {
+		if internal.HasApiKeyAuthorization(r) || isJSONRequest(r) {
+			internal.RespondWithError(w, http.StatusBadRequest, "no family")
+			return
+		}
+		a.FamilyNew(w, r, user)
+		return
+	}
+	family, err := a.DB.GetFamilyById(r.Context(), user.FamilyID.Int64)
 	if err != nil {
-		panic(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	defer tx.Rollback(r.Context())
-	txq := a.DB.WithTx(tx)
-
-	post, perr := txq.CreatePost(r.Context(), database.CreatePostParams{
-		UserID:    user.ID,
-		UpdatedAt: pgtype.Timestamp{Time: time.Now(), Valid: true},
-		CreatedAt: pgtype.Timestamp{Time: time.Now(), Valid: true},
-		FamilyID:  user.FamilyID.Int64,
-	})
-	if perr != nil {
-		form = uploadFormWithError(w, r, user, perr)
-		_, err := h.Render(r.Context(), form)
-		if err != nil {
+	// errors the uploader can fix are shown on the form, anything else is a server error
+	caption, results, err := a.receiveUploads(r, family)
+	formErr := uploadFormError(caption, results, err)
+	var files []internal.SavedFile
+	for _, result := range results {
+		if result.Err == nil {
+			files = append(files, result.Saved)
+		}
+	}
+	// when every file was refused there is nothing to post
+	if formErr == nil && len(files) == 0 && len(results) > 0 {
+		form = a.uploadFormWithResults(w, r, user, results, http.StatusUnprocessableEntity)
+		if _, err := h.Render(r.Context(), form); err != nil {
 			fmt.Printf("error rendering page: %v", err.Error())
 		}
 		return
 	}
-	for fileHeader := range internal.FileGenerator(files) {
-		filePath, uploadErr := internal.SaveFile(fileHeader)
-
-		if uploadErr != nil {
-			form = uploadFormWithError(w, r, user, uploadErr)
-			_, err := h.Render(r.Context(), form)
+	duplicates := 0
+	if formErr == nil {
+		err = a.withTx(r.Context(), func(txq *database.Queries) error {
+			post, err := txq.CreatePost(r.Context(), database.CreatePostParams{
+				Description: caption,
+				UserID:      user.ID,
+				FamilyID:    user.FamilyID.Int64,
+			})
 			if err != nil {
-				fmt.Printf("error rendering page: %v", err.Error())
+				return err
 			}
-			return
+			for _, saved := range files {
+				if saved.Duplicate {
+					duplicates++
+				}
+				if err := a.createPhoto(r.Context(), txq, user, family, post.ID, saved); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if formErr != nil || err != nil {
+		// nothing refers to the files stored before things went wrong
+		for _, saved := range files {
+			a.discardSaved(r.Context(), saved)
 		}
-		info, err := os.Stat(filePath)
+	}
+	if formErr != nil {
+		form = a.uploadFormWithError(w, r, user, formErr)
+		_, err := h.Render(r.Context(), form)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			fmt.Printf("error rendering page: %v", err.Error())
 		}
-		newPath := filepath.Join("/", "assets", "uploads", info.Name())
-
-		_, perr := txq.CreatePhoto(r.Context(), database.CreatePhotoParams{
-			ID:       uuid.NewString(),
-			UserID:   user.ID,
-			Url:      newPath,
-			ThumbUrl: newPath,
-			ModifiedAt: pgtype.Timestamp{
-				Time:             info.ModTime(),
-				InfinityModifier: pgtype.Finite,
-				Valid:            true,
-			},
-			Name:    info.Name(),
-			AltText: info.Name(),
-			PostID:  pgtype.Int8{Int64: post.ID, Valid: true},
-		})
-		if perr != nil {
-			http.Error(w, perr.Error(), http.StatusInternalServerError)
-			return
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the files that made it are posted, the form stays up to show which didn't and why
+	if len(files) < len(results) {
+		h.TriggerInfo(fmt.Sprintf("%d of %d files were posted", len(files), len(results)))
+		form = a.uploadFormWithResults(w, r, user, results, http.StatusOK)
+		if _, err := h.Render(r.Context(), form); err != nil {
+			fmt.Printf("error rendering page: %v", err.Error())
 		}
+		return
 	}
-	if err := tx.Commit(r.Context()); err != nil {
-		fmt.Println(err.Error())
-		panic(err)
+	if duplicates == 1 {
+		h.TriggerInfo("1 photo was already in the family, it was added without storing it again")
+	} else if duplicates > 1 {
+		h.TriggerInfo(fmt.Sprintf("%d photos were already in the family, they were added without storing them again", duplicates))
 	}
-	posts, _ := a.DB.GetPostsByUserFamilyAggregated(r.Context(), database.GetPostsByUserFamilyAggregatedParams{
-		FamilyID: user.FamilyID,
-		Limit:    10,
-	})
+	posts, next, _ := a.postsPage(r.Context(), user, "")
 	pageData["Posts"] = posts
+	pageData["NextCursor"] = next
 
 	page := htmx.NewComponent("views/index.html").SetData(pageData).
-		With(navbarWithUser(user), "Navbar").
-		With(htmx.NewComponent("views/posts-index.html").SetData(pageData), "Content")
+		With(a.navbarWithUser(r.Context(), user), "Navbar").
+		With(htmx.NewComponent("views/posts-index.html", "views/posts-page.html", "views/post.html", "views/reactions.html").SetData(pageData), "Content")
 	if _, herr := h.Render(r.Context(), page); herr != nil {
 		fmt.Println(herr.Error())
 		http.Error(w, herr.Error(), http.StatusInternalServerError)
@@ -441,20 +871,137 @@ func (a *App) PhotoCreate(w http.ResponseWriter, r *http.Request, user database.
 	}
 }
 
+// discardSaved removes the files of an upload that never made it into a photo
+func (a *App) discardSaved(ctx context.Context, saved internal.SavedFile) {
+	if saved.Duplicate {
+		return
+	}
+	a.deleteUnusedBlobs(ctx, a.Storage.URL(saved.Original.Key), a.Storage.URL(saved.Thumb.Key), a.Storage.URL(saved.Medium.Key))
+}
+
+// createPhoto records a saved file as a photo in a post, with the camera details the family wants kept
+func (a *App) createPhoto(ctx context.Context, txq *database.Queries, user database.User, family database.Family, postID int64, saved internal.SavedFile) error {
+	// photos are ordered by when they were taken, falling back to when they were uploaded
+	modifiedAt := saved.Original.ModTime
+	if !saved.Metadata.TakenAt.IsZero() {
+		modifiedAt = saved.Metadata.TakenAt
+	}
+	photo, err := txq.CreatePhoto(ctx, database.CreatePhotoParams{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		Url:       a.Storage.URL(saved.Original.Key),
+		ThumbUrl:  a.Storage.URL(saved.Thumb.Key),
+		MediumUrl: a.Storage.URL(saved.Medium.Key),
+		ModifiedAt: pgtype.Timestamp{
+			Time:             modifiedAt,
+			InfinityModifier: pgtype.Finite,
+			Valid:            true,
+		},
+		Name:        saved.Original.Key,
+		AltText:     saved.Original.Key,
+		PostID:      pgtype.Int8{Int64: postID, Valid: true},
+		ContentHash: pgtype.Text{String: saved.ContentHash, Valid: true},
+		PerceptualHash: pgtype.Int8{
+			Int64: int64(saved.PerceptualHash),
+			Valid: saved.HasPerceptualHash,
+		},
+		MediaType:  saved.MediaType,
+		Width:      pgtype.Int4{Int32: int32(saved.Width), Valid: saved.Width > 0},
+		Height:     pgtype.Int4{Int32: int32(saved.Height), Valid: saved.Height > 0},
+		DurationMs: pgtype.Int4{Int32: int32(saved.Duration.Milliseconds()), Valid: saved.MediaType == internal.MediaVideo},
+		Size:       pgtype.Int8{Int64: saved.Original.Size, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if !family.KeepLocations {
+		saved.Metadata.HasLocation = false
+	}
+	if !saved.HasMetadata {
+		return nil
+	}
+	return txq.CreatePhotoMetadata(ctx, photoMetadataParams(photo.ID, saved.Metadata))
+}
+
+// findFamilyUpload finds the blobs of a photo already posted in the family with the same content
+func (a *App) findFamilyUpload(ctx context.Context, q *database.Queries, familyID int64) internal.FindStored {
+	return func(hash string) (internal.SavedFile, bool, error) {
+		photo, err := q.GetFamilyPhotoByHash(ctx, database.GetFamilyPhotoByHashParams{
+			ContentHash: pgtype.Text{String: hash, Valid: true},
+			FamilyID:    familyID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return internal.SavedFile{}, false, nil
+		}
+		if err != nil {
+			return internal.SavedFile{}, false, err
+		}
+		return internal.SavedFile{
+			Original: internal.ObjectInfo{Key: internal.KeyFromURL(photo.Url), Size: photo.Size.Int64, ModTime: photo.ModifiedAt.Time},
+			Thumb:    internal.ObjectInfo{Key: internal.KeyFromURL(photo.ThumbUrl)},
+			Medium:   internal.ObjectInfo{Key: internal.KeyFromURL(photo.MediumUrl)},
+			// the same bytes hash the same, so the earlier photo's hash holds for this one
+			PerceptualHash:    uint64(photo.PerceptualHash.Int64),
+			HasPerceptualHash: photo.PerceptualHash.Valid,
+			MediaType:         photo.MediaType,
+			Width:             int(photo.Width.Int32),
+			Height:            int(photo.Height.Int32),
+			Duration:          time.Duration(photo.DurationMs.Int32) * time.Millisecond,
+		}, true, nil
+	}
+}
+
+func photoMetadataParams(photoID string, meta internal.PhotoMetadata) database.CreatePhotoMetadataParams {
+	params := database.CreatePhotoMetadataParams{
+		PhotoID:      photoID,
+		TakenAt:      pgtype.Timestamp{Time: meta.TakenAt, Valid: !meta.TakenAt.IsZero()},
+		CameraMake:   meta.CameraMake,
+		CameraModel:  meta.CameraModel,
+		LensModel:    meta.LensModel,
+		ExposureTime: meta.ExposureTime,
+		FNumber:      pgtype.Float8{Float64: meta.FNumber, Valid: meta.FNumber > 0},
+		Iso:          pgtype.Int4{Int32: int32(meta.ISO), Valid: meta.ISO > 0},
+		FocalLength:  pgtype.Float8{Float64: meta.FocalLength, Valid: meta.FocalLength > 0},
+		Orientation:  pgtype.Int4{Int32: int32(meta.Orientation), Valid: meta.Orientation > 0},
+	}
+	if meta.HasLocation {
+		params.Latitude = pgtype.Float8{Float64: meta.Latitude, Valid: true}
+		params.Longitude = pgtype.Float8{Float64: meta.Longitude, Valid: true}
+	}
+	return params
+}
+
 func (a *App) FamiliesGet(w http.ResponseWriter, r *http.Request, user database.User) {
 	h := a.htmx.NewHandler(w, r)
 	family, err := a.DB.GetUserFamily(r.Context(), user.ID)
+	if errors.Is(err, pgx.ErrNoRows) && !isJSONRequest(r) {
+		a.FamilyNew(w, r, user)
+		return
+	}
 	if err != nil {
 		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "no family")
+		return
 	}
-	users, _ := a.DB.GetUsersByFamily(r.Context(), user.FamilyID)
+	users, _ := a.DB.GetUsersByFamily(r.Context(), family.ID)
+	if isJSONRequest(r) {
+		internal.RespondWithJSON(w, http.StatusOK, familyResponse(family, users))
+		return
+	}
+	invites, _ := a.DB.GetPendingFamilyInvites(r.Context(), family.ID)
+	membership, _ := a.DB.GetFamilyMembership(r.Context(), database.GetFamilyMembershipParams{
+		UserID:   user.ID,
+		FamilyID: family.ID,
+	})
 	data := map[string]any{
 		"Family":        family,
 		"FamilyMembers": users,
+		"Invites":       invites,
+		"IsAdmin":       membership.Role == roleAdmin,
 	}
 
 	component := htmx.NewComponent("views/family.html").SetData(data)
-	page := mainContentWithNavbar("Phamily Photos Families", navbarWithUser(user))
+	component.AddTemplateFunction("formatDate", formatDate)
+	page := mainContentWithNavbar("Phamily Photos Families", a.navbarWithUser(r.Context(), user))
 	page.With(component, "Content")
 
 	_, herr := h.Render(r.Context(), page)
@@ -517,17 +1064,28 @@ func (a *App) Login(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func uploadFormWithError(w http.ResponseWriter, _ *http.Request, user database.User, err error) htmx.RenderableComponent {
-	formData := map[string]any{
-		"Errors": []error{err},
+func (a *App) uploadFormWithError(w http.ResponseWriter, r *http.Request, user database.User, err error) htmx.RenderableComponent {
+	message := err.Error()
+	var uploadErr *internal.UploadError
+	if errors.As(err, &uploadErr) {
+		message = uploadErr.Message
 	}
+	return a.uploadForm(w, r, user, map[string]any{"Errors": []string{message}}, http.StatusUnprocessableEntity)
+}
+
+// uploadFormWithResults shows which files of an upload were posted and why the others weren't
+func (a *App) uploadFormWithResults(w http.ResponseWriter, r *http.Request, user database.User, results []uploadResult, status int) htmx.RenderableComponent {
+	return a.uploadForm(w, r, user, map[string]any{"Results": results}, status)
+}
+
+func (a *App) uploadForm(w http.ResponseWriter, r *http.Request, user database.User, formData map[string]any, status int) htmx.RenderableComponent {
 	pageData := map[string]any{
 		"Title": "Phamily Photos Photo",
 	}
 	component := htmx.NewComponent("views/photo-new.html").SetData(formData)
-	page := htmx.NewComponent("views/index.html").SetData(pageData).With(navbarWithUser(user), "Navbar")
+	page := htmx.NewComponent("views/index.html").SetData(pageData).With(a.navbarWithUser(r.Context(), user), "Navbar")
 	page.With(component, "Content")
-	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.WriteHeader(status)
 	return page
 }
 
@@ -549,7 +1107,7 @@ func navbarWithoutUser() htmx.RenderableComponent {
 	return navbar.SetData(data)
 }
 
-func navbarWithUser(user database.User) htmx.RenderableComponent {
+func (a *App) navbarWithUser(ctx context.Context, user database.User) htmx.RenderableComponent {
 	menuItems := []struct {
 		Name      string
 		Link      string
@@ -559,11 +1117,16 @@ func navbarWithUser(user database.User) htmx.RenderableComponent {
 		{"Photos", "/photos", "true"},
 		{"New", "/photos/new", "true"},
 		{"Family", "/family", "true"},
+		{"Trash", "/trash", "true"},
 		{"Logout", "/logout", "false"},
 	}
+	// the switcher shows once the user belongs to more than one family
+	families, _ := a.DB.GetUserFamilies(ctx, user.ID)
 	data := map[string]any{
 		"User":      user,
 		"MenuItems": menuItems,
+		"Families":  families,
+		"FamilyID":  user.FamilyID.Int64,
 	}
 
 	navbar := htmx.NewComponent("views/navbar.html")
@@ -580,3 +1143,13 @@ func mainContentWithNavbar(title string, navbar htmx.RenderableComponent) htmx.R
 func formatDate(t time.Time) string {
 	return t.Format(time.DateOnly)
 }
+
+// formatDuration shows a video's length in milliseconds the way players do, 1:05 or 1:02:05
+func formatDuration(ms int32) string {
+	d := time.Duration(ms) * time.Millisecond
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
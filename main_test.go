@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadFormError(t *testing.T) {
+	posted := []uploadResult{{Filename: "beach.png"}}
+	refused := []uploadResult{{Filename: "notes.txt", Err: internal.ErrUnknownFileType}}
+	broken := errors.New("unexpected EOF")
+	tests := []struct {
+		name    string
+		caption string
+		results []uploadResult
+		err     error
+		want    error
+	}{
+		{name: "a file", caption: "Sunny day", results: posted},
+		{name: "no files", results: nil, want: errNoFiles},
+		{name: "a caption but no files", caption: "Sunny day", results: nil, want: errNoFiles},
+		// the results say why each file was refused
+		{name: "every file refused", results: refused},
+		{name: "caption too long", caption: strings.Repeat("a", maxCaptionLength+1), results: posted, want: errCaptionTooLong},
+		{name: "too big", err: &http.MaxBytesError{Limit: internal.MaxRequestSize}, want: errUploadTooBig},
+		{name: "broken form", results: posted, err: broken, want: broken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, uploadFormError(tt.caption, tt.results, tt.err))
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donseba/go-htmx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/rowinf/phamily-photos/internal/database"
+)
+
+const maxCaptionLength = 2000
+
+// otherPhotosLimit is how many of the user's photos in other posts the post editor offers to add
+const otherPhotosLimit = 30
+
+var (
+	errCaptionTooLong = &internal.UploadError{Code: "CAPTION_TOO_LONG", Message: "The caption is too long, it can be up to 2000 characters."}
+	errNotPostPhoto   = errors.New("NOT_POST_PHOTO")
+	errNotMyPhoto     = errors.New("NOT_MY_PHOTO")
+	errNoPhotos       = errors.New("NO_PHOTOS")
+	errBadDirection   = errors.New("BAD_DIRECTION")
+)
+
+// PostParams are nil when left out, a PATCH keeps those fields while a PUT clears them
+type PostParams struct {
+	Description     *string `json:"description"`
+	FeaturedPhotoId *string `json:"featured_photo_id"`
+}
+
+type PostResponse struct {
+	Id              int64  `json:"id"`
+	CreatedAt       string `json:"created_at"`
+	UpdatedAt       string `json:"updated_at"`
+	Description     string `json:"description"`
+	FeaturedPhotoId string `json:"featured_photo_id"`
+	UserId          string `json:"user_id"`
+}
+
+// PostPhotosParams are the photos to move into a post
+type PostPhotosParams struct {
+	PhotoIds []string `json:"photo_ids"`
+}
+
+// PostPhotoMoveParams say which way a photo moves in its post, up or down
+type PostPhotoMoveParams struct {
+	Direction string `json:"direction"`
+}
+
+func readPostParams(r *http.Request) (PostParams, error) {
+	body := PostParams{}
+	if isJSONRequest(r) {
+		err := json.NewDecoder(r.Body).Decode(&body)
+		return body, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return body, err
+	}
+	if _, ok := r.PostForm["description"]; ok {
+		description := r.PostForm.Get("description")
+		body.Description = &description
+	}
+	if _, ok := r.PostForm["featured_photo_id"]; ok {
+		featured := r.PostForm.Get("featured_photo_id")
+		body.FeaturedPhotoId = &featured
+	}
+	return body, nil
+}
+
+func readPostPhotosParams(r *http.Request) (PostPhotosParams, error) {
+	body := PostPhotosParams{}
+	if isJSONRequest(r) {
+		err := json.NewDecoder(r.Body).Decode(&body)
+		return body, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return body, err
+	}
+	body.PhotoIds = r.PostForm["photo_id"]
+	return body, nil
+}
+
+func readPostPhotoMoveParams(r *http.Request) (PostPhotoMoveParams, error) {
+	body := PostPhotoMoveParams{}
+	if isJSONRequest(r) {
+		err := json.NewDecoder(r.Body).Decode(&body)
+		return body, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return body, err
+	}
+	body.Direction = r.PostForm.Get("direction")
+	return body, nil
+}
+
+// postPhoto is one of a post's photos as the post editor lists them
+type postPhoto struct {
+	ID          string
+	Name        string
+	Featured    bool
+	Checked     bool
+	CanMoveUp   bool
+	CanMoveDown bool
+}
+
+// postPhotos lists the photos aggregated into a post in the order they are shown. The featured photo
+// always comes first, the others are moved around it.
+func postPhotos(post database.GetFamilyPostAggregatedRow) []postPhoto {
+	items, _ := post.Photos.([]any)
+	photos := make([]postPhoto, 0, len(items))
+	for _, item := range items {
+		photo, _ := item.(map[string]any)
+		id, _ := photo["photo_id"].(string)
+		name, _ := photo["photo_name"].(string)
+		photos = append(photos, postPhoto{ID: id, Name: name, Featured: id == post.PostFeaturedPhotoID.String})
+	}
+	if len(photos) == 0 {
+		return photos
+	}
+	// without a featured photo the first one is shown first, the editor offers it as the featured one
+	photos[0].Checked = true
+	movable := photos
+	if photos[0].Featured {
+		movable = photos[1:]
+	}
+	for i := range movable {
+		movable[i].CanMoveUp = i > 0
+		movable[i].CanMoveDown = i < len(movable)-1
+	}
+	return photos
+}
+
+// familyPost finds a post in the user's selected family, it is not found for anyone else
+func (a *App) familyPost(r *http.Request, user database.User) (database.GetFamilyPostAggregatedRow, error) {
+	postID, err := strconv.ParseInt(r.PathValue("postID"), 10, 64)
+	if err != nil {
+		return database.GetFamilyPostAggregatedRow{}, pgx.ErrNoRows
+	}
+	return a.DB.GetFamilyPostAggregated(r.Context(), database.GetFamilyPostAggregatedParams{
+		ID:       postID,
+		FamilyID: user.FamilyID.Int64,
+		UserID:   user.ID,
+	})
+}
+
+func (a *App) renderPost(w http.ResponseWriter, r *http.Request, user database.User, data map[string]any, templates ...string) {
+	h := a.htmx.NewHandler(w, r)
+	component := htmx.NewComponent(templates...).SetData(data)
+	// the inline editor swaps just the article, anything else gets the whole page
+	page := component
+	if !h.IsHxRequest() || h.IsHxBoosted() {
+		page = mainContentWithNavbar("Phamily Photos Post", a.navbarWithUser(r.Context(), user))
+		page.With(component, "Content")
+	}
+
+	_, err := h.Render(r.Context(), page)
+	if err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+// renderPostEdit shows the editor of one of the user's posts, with their photos in other posts to add to it
+func (a *App) renderPostEdit(w http.ResponseWriter, r *http.Request, user database.User, post database.GetFamilyPostAggregatedRow) {
+	others, err := a.DB.GetUserPhotosOutsidePost(r.Context(), database.GetUserPhotosOutsidePostParams{
+		UserID:   user.ID,
+		FamilyID: user.FamilyID.Int64,
+		PostID:   pgtype.Int8{Int64: post.PostID, Valid: true},
+		Limit:    otherPhotosLimit,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(a.htmx.NewHandler(w, r), w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.renderPost(w, r, user, map[string]any{
+		"Post":        post,
+		"Photos":      postPhotos(post),
+		"OtherPhotos": others,
+	}, "views/post-edit.html")
+}
+
+func (a *App) PostGet(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, err := a.familyPost(r, user)
+	if err != nil {
+		internal.RespondWithError(w, http.StatusNotFound, "not found")
+		return
+	}
+	a.renderPost(w, r, user, map[string]any{"Post": post}, "views/post.html", "views/reactions.html")
+}
+
+// PostEdit swaps the post for an inline form to change its caption and featured photo
+func (a *App) PostEdit(w http.ResponseWriter, r *http.Request, user database.User) {
+	post, err := a.familyPost(r, user)
+	if err != nil || !post.IsMyPost {
+		internal.RespondWithError(w, http.StatusNotFound, "not found")
+		return
+	}
+	a.renderPostEdit(w, r, user, post)
+}
+
+// PostUpdate changes the caption and featured photo of one of the user's own posts
+func (a *App) PostUpdate(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	post, err := a.familyPost(r, user)
+	if err != nil || !post.IsMyPost {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	body, err := readPostParams(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	description := post.PostDescription
+	featured := post.PostFeaturedPhotoID
+	if r.Method == http.MethodPut {
+		description = ""
+		featured = pgtype.Text{}
+	}
+	if body.Description != nil {
+		description = strings.TrimSpace(*body.Description)
+	}
+	if len(description) > maxCaptionLength {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, errCaptionTooLong.Error())
+		return
+	}
+	if body.FeaturedPhotoId != nil {
+		featured = pgtype.Text{}
+		if *body.FeaturedPhotoId != "" {
+			photo, err := a.DB.GetFamilyPhoto(r.Context(), database.GetFamilyPhotoParams{
+				ID:       *body.FeaturedPhotoId,
+				FamilyID: user.FamilyID.Int64,
+			})
+			if err != nil || photo.PostID.Int64 != post.PostID {
+				internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, errNotPostPhoto.Error())
+				return
+			}
+			featured = pgtype.Text{String: photo.ID, Valid: true}
+		}
+	}
+
+	updated, err := a.DB.UpdatePost(r.Context(), database.UpdatePostParams{
+		ID:              post.PostID,
+		UserID:          user.ID,
+		Description:     description,
+		FeaturedPhotoID: featured,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if isJSONRequest(r) {
+		internal.RespondWithJSON(w, http.StatusOK, PostResponse{
+			Id:              updated.ID,
+			CreatedAt:       updated.CreatedAt.Time.Format(time.DateTime),
+			UpdatedAt:       updated.UpdatedAt.Time.Format(time.DateTime),
+			Description:     updated.Description,
+			FeaturedPhotoId: updated.FeaturedPhotoID.String,
+			UserId:          updated.UserID,
+		})
+		return
+	}
+	post, err = a.familyPost(r, user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.renderPost(w, r, user, map[string]any{"Post": post}, "views/post.html", "views/reactions.html")
+}
+
+// PostDelete moves one of the user's posts to the trash along with its photos
+func (a *App) PostDelete(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	postID, err := strconv.ParseInt(r.PathValue("postID"), 10, 64)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	rows, err := a.DB.TrashPost(r.Context(), database.TrashPostParams{
+		ID:     postID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rows == 0 {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	h.TriggerInfo("The post was moved to the trash, it can be restored for 30 days")
+	internal.RespondWithOk(w)
+}
+
+// movePhotosToPost moves the user's photos into one of their posts, all or nothing. The posts they leave
+// without photos go to the trash, taking their comments and reactions along so they can be restored.
+func movePhotosToPost(ctx context.Context, txq *database.Queries, user database.User, postID int64, ids []string) (trashed int64, err error) {
+	from, err := txq.UpdatePhotosPostId(ctx, database.UpdatePhotosPostIdParams{
+		PostID:   pgtype.Int8{Int64: postID, Valid: true},
+		Ids:      ids,
+		UserID:   user.ID,
+		FamilyID: user.FamilyID.Int64,
+	})
+	if err != nil {
+		return 0, err
+	}
+	// any of them can't be moved when it isn't theirs
+	if len(from) != len(ids) {
+		return 0, errNotMyPhoto
+	}
+	if err := txq.ClearMovedFeaturedPhotos(ctx, user.ID); err != nil {
+		return 0, err
+	}
+	slices.Sort(from)
+	return txq.TrashEmptyPosts(ctx, database.TrashEmptyPostsParams{
+		Ids:    slices.Compact(from),
+		UserID: user.ID,
+	})
+}
+
+// PostPhotosAdd moves photos from the user's other posts in the family into one of their posts, a post
+// left without photos is moved to the trash
+func (a *App) PostPhotosAdd(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	post, err := a.familyPost(r, user)
+	if err != nil || !post.IsMyPost {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	body, err := readPostPhotosParams(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slices.Sort(body.PhotoIds)
+	ids := slices.Compact(body.PhotoIds)
+	if len(ids) == 0 {
+		internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, errNoPhotos.Error())
+		return
+	}
+	var trashed int64
+	err = a.withTx(r.Context(), func(txq *database.Queries) error {
+		trashed, err = movePhotosToPost(r.Context(), txq, user, post.PostID, ids)
+		return err
+	})
+	if errors.Is(err, errNotMyPhoto) {
+		internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if trashed > 0 {
+		h.TriggerInfo("Posts left without photos were moved to the trash, they can be restored for 30 days")
+	}
+	a.postPhotosChanged(w, r, user)
+}
+
+// PostPhotoMove swaps a photo with the one before or after it in its post
+func (a *App) PostPhotoMove(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	post, err := a.familyPost(r, user)
+	if err != nil || !post.IsMyPost {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	body, err := readPostPhotoMoveParams(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset := 0
+	switch body.Direction {
+	case "up":
+		offset = -1
+	case "down":
+		offset = 1
+	default:
+		internal.RespondWithErrorHtmx(h, w, http.StatusBadRequest, errBadDirection.Error())
+		return
+	}
+	// the featured photo stays first
+	var ids []string
+	for _, photo := range postPhotos(post) {
+		if !photo.Featured {
+			ids = append(ids, photo.ID)
+		}
+	}
+	i := slices.Index(ids, r.PathValue("photoID"))
+	if i < 0 {
+		internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, errNotPostPhoto.Error())
+		return
+	}
+	if j := i + offset; j >= 0 && j < len(ids) {
+		ids[i], ids[j] = ids[j], ids[i]
+		err = a.DB.SetPhotosSortOrder(r.Context(), database.SetPhotosSortOrderParams{
+			Ids:    ids,
+			PostID: pgtype.Int8{Int64: post.PostID, Valid: true},
+		})
+		if err != nil {
+			internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	a.postPhotosChanged(w, r, user)
+}
+
+// postPhotosChanged shows the editor again after the photos of a post changed, API clients only get a 200
+func (a *App) postPhotosChanged(w http.ResponseWriter, r *http.Request, user database.User) {
+	if isJSONRequest(r) {
+		internal.RespondWithOk(w)
+		return
+	}
+	post, err := a.familyPost(r, user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(a.htmx.NewHandler(w, r), w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.renderPostEdit(w, r, user, post)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rowinf/phamily-photos/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDB answers the queries moving photos, the photos came from the posts in movedFrom
+type fakeDB struct {
+	movedFrom []int64
+	// queries are the names of the queries run, with the arguments they were given
+	queries []string
+	args    map[string][]any
+}
+
+func (f *fakeDB) record(sql string, args []any) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(sql, "-- name: "), " ")
+	f.queries = append(f.queries, name)
+	if f.args == nil {
+		f.args = map[string][]any{}
+	}
+	f.args[name] = args
+}
+
+func (f *fakeDB) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	f.record(sql, args)
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (f *fakeDB) Query(_ context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	f.record(sql, args)
+	return &fakeRows{ids: f.movedFrom, pos: -1}, nil
+}
+
+func (f *fakeDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	f.record(sql, args)
+	return nil
+}
+
+// fakeRows is a result of one bigint column
+type fakeRows struct {
+	ids []int64
+	pos int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("UPDATE") }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+func (r *fakeRows) Values() ([]any, error)                       { return []any{r.ids[r.pos]}, nil }
+
+func (r *fakeRows) Next() bool {
+	r.pos++
+	return r.pos < len(r.ids)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	*dest[0].(*int64) = r.ids[r.pos]
+	return nil
+}
+
+func TestMovePhotosToPost(t *testing.T) {
+	user := database.User{ID: "user", FamilyID: pgtype.Int8{Int64: 7, Valid: true}}
+	tests := []struct {
+		name        string
+		ids         []string
+		movedFrom   []int64
+		wantErr     error
+		wantQueries []string
+		wantTrashed []int64
+	}{
+		{
+			name:        "posts the photos left are checked once each",
+			ids:         []string{"a", "b", "c"},
+			movedFrom:   []int64{5, 3, 5},
+			wantQueries: []string{"UpdatePhotosPostId", "ClearMovedFeaturedPhotos", "TrashEmptyPosts"},
+			wantTrashed: []int64{3, 5},
+		},
+		{
+			name:        "a photo that isn't theirs moves nothing",
+			ids:         []string{"a", "b"},
+			movedFrom:   []int64{5},
+			wantErr:     errNotMyPhoto,
+			wantQueries: []string{"UpdatePhotosPostId"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{movedFrom: tt.movedFrom}
+			trashed, err := movePhotosToPost(context.Background(), database.New(db), user, 1, tt.ids)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantQueries, db.queries)
+			if tt.wantTrashed == nil {
+				assert.Zero(t, trashed)
+				return
+			}
+			assert.Equal(t, int64(1), trashed)
+			assert.Equal(t, []any{tt.wantTrashed, user.ID}, db.args["TrashEmptyPosts"])
+		})
+	}
+}
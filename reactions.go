@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/donseba/go-htmx"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/rowinf/phamily-photos/internal/database"
+)
+
+// reactionEmojis are the reactions people can pick from, views/reactions.html offers the same ones
+var reactionEmojis = []string{"❤️", "😂", "😮", "😢", "👍", "🎉"}
+
+var errUnknownEmoji = errors.New("UNKNOWN_EMOJI")
+
+// readReactionEmoji is the emoji of the button that was pressed, only the ones on offer are taken
+func readReactionEmoji(r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	emoji := r.PostForm.Get("emoji")
+	if !slices.Contains(reactionEmojis, emoji) {
+		return "", errUnknownEmoji
+	}
+	return emoji, nil
+}
+
+// renderReactions shows the reactions to a post or photo after one was toggled, in place of the old ones
+func (a *App) renderReactions(w http.ResponseWriter, r *http.Request, reactions any) {
+	h := a.htmx.NewHandler(w, r)
+	component := htmx.NewComponent("views/reactions.html").SetData(map[string]any{"Reactions": reactions})
+	if _, err := h.Render(r.Context(), component); err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+// PostReactionToggle adds the user's reaction to a post in their family, or takes it back when they
+// already reacted with that emoji
+func (a *App) PostReactionToggle(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	post, err := a.familyPost(r, user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	emoji, err := readReactionEmoji(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	postID := pgtype.Int8{Int64: post.PostID, Valid: true}
+	err = a.withTx(r.Context(), func(txq *database.Queries) error {
+		removed, err := txq.DeletePostReaction(r.Context(), database.DeletePostReactionParams{
+			PostID: postID,
+			UserID: user.ID,
+			Emoji:  emoji,
+		})
+		if err != nil || removed > 0 {
+			return err
+		}
+		return txq.CreatePostReaction(r.Context(), database.CreatePostReactionParams{
+			PostID: postID,
+			UserID: user.ID,
+			Emoji:  emoji,
+		})
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	post, err = a.familyPost(r, user)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.renderReactions(w, r, post.Reactions)
+}
+
+// PhotoReactionToggle adds the user's reaction to a photo in their family, or takes it back when they
+// already reacted with that emoji
+func (a *App) PhotoReactionToggle(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	params := database.GetPhotoParams{
+		ID:     r.PathValue("photoID"),
+		UserID: user.ID,
+	}
+	photo, err := a.DB.GetPhoto(r.Context(), params)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	emoji, err := readReactionEmoji(r)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	photoID := pgtype.Text{String: photo.ID, Valid: true}
+	err = a.withTx(r.Context(), func(txq *database.Queries) error {
+		removed, err := txq.DeletePhotoReaction(r.Context(), database.DeletePhotoReactionParams{
+			PhotoID: photoID,
+			UserID:  user.ID,
+			Emoji:   emoji,
+		})
+		if err != nil || removed > 0 {
+			return err
+		}
+		return txq.CreatePhotoReaction(r.Context(), database.CreatePhotoReactionParams{
+			PhotoID: photoID,
+			UserID:  user.ID,
+			Emoji:   emoji,
+		})
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	photo, err = a.DB.GetPhoto(r.Context(), params)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.renderReactions(w, r, photo.Reactions)
+}
@@ -0,0 +1,30 @@
+-- name: GetPostComments :many
+SELECT c.*, u.name AS user_name, c.user_id = $2 AS is_my_comment, p.user_id = $2 AS is_my_post
+    FROM comments AS c
+    JOIN users AS u ON c.user_id = u.id
+    JOIN posts AS p ON c.post_id = p.id
+    WHERE c.post_id=$1
+    ORDER BY c.created_at ASC, c.id ASC;
+
+-- name: GetFamilyComment :one
+-- a comment is only found in the family of its post
+SELECT c.*, u.name AS user_name, c.user_id = $3 AS is_my_comment, p.user_id = $3 AS is_my_post
+    FROM comments AS c
+    JOIN users AS u ON c.user_id = u.id
+    JOIN posts AS p ON c.post_id = p.id
+    WHERE c.id=$1 AND p.family_id=$2 AND p.deleted_at IS NULL;
+
+-- name: CreateComment :one
+INSERT INTO comments (post_id, user_id, body, created_at, updated_at)
+VALUES ($1, $2, $3, NOW(), NOW())
+RETURNING *;
+
+-- name: UpdateComment :one
+UPDATE comments
+SET body = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteComment :exec
+DELETE FROM comments
+WHERE id = $1;
@@ -1,6 +1,6 @@
 -- name: CreateFamily :one
-INSERT INTO families (id, created_at, updated_at, name, description)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO families (created_at, updated_at, name, description)
+VALUES (NOW(), NOW(), $1, $2)
 RETURNING *;
 
 -- name: GetFamilyById :one
@@ -13,4 +13,10 @@ WHERE id = (
     SELECT family_id
 		FROM users as u
         WHERE u.id=$1
-);
\ No newline at end of file
+);
+
+-- name: UpdateFamily :one
+UPDATE families
+SET name = $2, description = $3, location_exif = $4, keep_locations = $5, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
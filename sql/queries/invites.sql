@@ -0,0 +1,22 @@
+-- name: CreateFamilyInvite :one
+INSERT INTO family_invites (token_hash, family_id, created_by, created_at, expires_at)
+VALUES ($1, $2, $3, NOW(), $4)
+RETURNING *;
+
+-- name: GetFamilyInvite :one
+SELECT i.*, f.name AS family_name
+    FROM family_invites AS i
+    JOIN families AS f ON i.family_id = f.id
+    WHERE i.token_hash=$1 AND i.used_at IS NULL AND i.expires_at > NOW();
+
+-- name: UseFamilyInvite :execrows
+UPDATE family_invites
+SET used_at = NOW(), used_by = $2
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW();
+
+-- name: GetPendingFamilyInvites :many
+SELECT i.*, u.name AS created_by_name
+    FROM family_invites AS i
+    JOIN users AS u ON i.created_by = u.id
+    WHERE i.family_id=$1 AND i.used_at IS NULL AND i.expires_at > NOW()
+    ORDER BY i.created_at DESC;
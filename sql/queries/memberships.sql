@@ -0,0 +1,24 @@
+-- name: CreateFamilyMembership :exec
+INSERT INTO family_memberships (user_id, family_id, role, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id, family_id) DO NOTHING;
+
+-- name: GetFamilyMembership :one
+SELECT * FROM family_memberships
+WHERE user_id = $1 AND family_id = $2;
+
+-- name: GetUserFamilies :many
+SELECT f.id, f.name, m.role
+    FROM family_memberships AS m
+    JOIN families AS f ON m.family_id = f.id
+    WHERE m.user_id = $1
+    ORDER BY f.name ASC;
+
+-- name: SetFamilyMembershipRole :execrows
+UPDATE family_memberships
+SET role = $3
+WHERE user_id = $1 AND family_id = $2;
+
+-- name: DeleteFamilyMembership :execrows
+DELETE FROM family_memberships
+WHERE user_id = $1 AND family_id = $2;
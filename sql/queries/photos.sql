@@ -1,40 +1,22 @@
+-- name: CountPhotosByUrl :one
+SELECT COUNT(*) FROM photos
+WHERE url = $1;
+
 -- name: CreatePhoto :one
-INSERT INTO photos (id, created_at, updated_at, modified_at, name, alt_text, url, thumb_url, user_id, post_id)
-VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, $6, $7, $8)
+INSERT INTO photos (id, modified_at, name, alt_text, url, thumb_url, medium_url, user_id, post_id, content_hash, perceptual_hash, media_type, width, height, duration_ms, size)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 RETURNING *, TRUE AS is_my_photo;
 
--- name: GetPhotosByUser :many
-SELECT * FROM photos AS p 
-    JOIN users AS u ON p.user_id = u.id 
-    WHERE u.id=$1
-    ORDER BY p.modified_at DESC
-    LIMIT $2;
+-- name: CreatePhotoMetadata :exec
+INSERT INTO photo_metadata (
+    photo_id, taken_at, camera_make, camera_model, lens_model, exposure_time,
+    f_number, iso, focal_length, latitude, longitude, orientation
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);
 
--- name: GetPostsByUserFamily :many
-SELECT 
-    p.id AS post_id,
-    p.created_at AS post_created_at,
-    p.updated_at AS post_updated_at,
-    p.description AS post_description,
-    u.name AS user_name,
-    f.name AS family_name,
-    ph.id AS photo_id,
-    ph.name AS photo_name,
-    ph.url AS photo_url,
-    ph.thumb_url AS photo_thumb_url
-FROM 
-    posts p
-JOIN 
-    users u ON p.user_id = u.id
-JOIN 
-    families f ON p.family_id = f.id
-LEFT JOIN 
-    photos ph ON ph.post_id = p.id
-WHERE
-    p.family_id = $1
-ORDER BY
-    p.created_at DESC
-LIMIT $2;
+-- name: GetPhotoMetadata :one
+SELECT * FROM photo_metadata
+WHERE photo_id = $1;
 
 -- name: GetPostsByUserFamilyAggregated :many
 SELECT
@@ -42,53 +24,174 @@ SELECT
     p.created_at AS post_created_at,
     p.updated_at AS post_updated_at,
     p.description AS post_description,
+    p.featured_photo_id AS post_featured_photo_id,
+    p.user_id = $3 AS is_my_post,
     u.name AS user_name,
     f.name AS family_name,
+    (SELECT COUNT(*) FROM comments AS c WHERE c.post_id = p.id) AS comment_count,
+    (SELECT json_agg(json_build_object('emoji', r.emoji, 'count', r.count, 'users', r.users, 'mine', r.mine) ORDER BY r.first_at)
+        FROM (
+            SELECT re.emoji, COUNT(*) AS count, json_agg(ru.name ORDER BY re.created_at) AS users,
+                bool_or(re.user_id = $3) AS mine, MIN(re.created_at) AS first_at
+            FROM reactions AS re
+                JOIN users AS ru ON re.user_id = ru.id
+            WHERE re.post_id = p.id
+            GROUP BY re.emoji
+        ) AS r) AS reactions,
     json_arrayagg(json_build_object(
         'photo_id', ph.id,
         'photo_name', ph.name,
         'photo_url', ph.url,
-        'photo_thumb_url', ph.thumb_url
-    )) AS photos
+        'photo_thumb_url', ph.thumb_url,
+        'photo_medium_url', ph.medium_url,
+        'media_type', ph.media_type,
+        'has_preview', ph.thumb_url <> ph.url
+    ) ORDER BY ph.id = p.featured_photo_id DESC, ph.sort_order ASC NULLS LAST, ph.modified_at ASC) AS photos
 FROM 
     posts p
 JOIN 
     users u ON p.user_id = u.id
 JOIN 
-    families f ON u.family_id = f.id
-LEFT JOIN 
-    photos ph ON ph.post_id = p.id
+    families f ON p.family_id = f.id
+JOIN 
+    photos ph ON ph.post_id = p.id AND ph.deleted_at IS NULL
 WHERE 
-    u.family_id = $1
+    p.family_id = $1 AND p.deleted_at IS NULL
+    AND (sqlc.narg('before_created_at')::timestamp IS NULL
+        OR (p.created_at, p.id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::bigint))
 GROUP BY 
     p.id, u.name, f.name
 ORDER BY 
-    p.created_at DESC
-LIMIT $2;
-
--- name: GetPhotosByUserFamily :many
-SELECT p.*, u.name as user_name, p.user_id = $1 AS is_my_photo
-FROM public.photos AS p
-	JOIN users AS u ON p.user_id = u.id
-	WHERE u.family_id = (
-		SELECT family_id
-            FROM users as u
-            WHERE u.id=$1
-	)
-ORDER BY p.modified_at DESC
+    p.created_at DESC, p.id DESC
 LIMIT $2;
 
 -- name: GetPhoto :one
-SELECT *, p.user_id = $2 AS is_my_photo, u.name AS user_name 
+SELECT p.*, p.user_id = $2 AS is_my_photo, u.name AS user_name,
+    (SELECT json_agg(json_build_object('emoji', r.emoji, 'count', r.count, 'users', r.users, 'mine', r.mine) ORDER BY r.first_at)
+        FROM (
+            SELECT re.emoji, COUNT(*) AS count, json_agg(ru.name ORDER BY re.created_at) AS users,
+                bool_or(re.user_id = $2) AS mine, MIN(re.created_at) AS first_at
+            FROM reactions AS re
+                JOIN users AS ru ON re.user_id = ru.id
+            WHERE re.photo_id = p.id
+            GROUP BY re.emoji
+        ) AS r) AS reactions
     FROM photos AS p
     JOIN users AS u ON p.user_id = u.id
-    WHERE p.id=$1 AND user_id=$2;
+    WHERE p.id=$1 AND p.deleted_at IS NULL AND p.post_id IN (
+        SELECT po.id FROM posts AS po
+            JOIN users AS me ON po.family_id = me.family_id
+            WHERE me.id=$2 AND po.deleted_at IS NULL
+    );
+
+-- name: GetFamilyNearDuplicates :many
+SELECT
+    a.id AS photo_id,
+    a.user_id = sqlc.arg('user_id') AS is_my_photo,
+    ua.name AS user_name,
+    a.created_at,
+    b.id AS other_photo_id,
+    b.user_id = sqlc.arg('user_id') AS is_my_other_photo,
+    ub.name AS other_user_name,
+    b.created_at AS other_created_at,
+    bit_count((a.perceptual_hash # b.perceptual_hash)::bit(64))::int AS distance
+FROM photos AS a
+    JOIN posts AS pa ON a.post_id = pa.id
+    JOIN users AS ua ON a.user_id = ua.id
+    JOIN photos AS b ON a.id < b.id
+    JOIN posts AS pb ON b.post_id = pb.id
+    JOIN users AS ub ON b.user_id = ub.id
+WHERE pa.family_id = sqlc.arg('family_id') AND pb.family_id = sqlc.arg('family_id')
+    AND a.deleted_at IS NULL AND b.deleted_at IS NULL AND pa.deleted_at IS NULL AND pb.deleted_at IS NULL
+    AND bit_count((a.perceptual_hash # b.perceptual_hash)::bit(64)) <= sqlc.arg('max_distance')::int
+    AND (sqlc.narg('after_distance')::int IS NULL
+        OR (-bit_count((a.perceptual_hash # b.perceptual_hash)::bit(64))::int, a.created_at, a.id, b.id)
+            < (-sqlc.narg('after_distance')::int, sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_photo_id')::text, sqlc.narg('after_other_photo_id')::text))
+ORDER BY distance ASC, a.created_at DESC, a.id DESC, b.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetFamilyPhoto :one
+SELECT ph.* FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+    WHERE ph.id=$1 AND p.family_id=$2 AND ph.deleted_at IS NULL AND p.deleted_at IS NULL;
+
+-- name: GetFamilyPhotoByHash :one
+SELECT ph.* FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+    WHERE ph.content_hash=$1 AND p.family_id=$2 AND ph.deleted_at IS NULL AND p.deleted_at IS NULL
+    ORDER BY ph.created_at ASC
+    LIMIT 1;
+
+-- name: GetFamilyStorageUsed :one
+-- photos sharing the files of a duplicate upload only count once
+SELECT COALESCE(SUM(stored.size), 0)::bigint AS used FROM (
+    SELECT DISTINCT ON (ph.url) ph.size FROM photos AS ph
+        JOIN posts AS p ON ph.post_id = p.id
+        WHERE p.family_id = $1
+) AS stored;
 
--- name: DeletePhoto :exec
-DELETE FROM photos
-    WHERE id=$1 AND user_id=$2;
+-- name: CopyPhotoMetadata :exec
+-- gives a photo the camera details of another when it has none of its own, the other keeps its copy
+INSERT INTO photo_metadata (photo_id, taken_at, camera_make, camera_model, lens_model, exposure_time,
+    f_number, iso, focal_length, latitude, longitude, orientation)
+SELECT sqlc.arg('into_id'), taken_at, camera_make, camera_model, lens_model, exposure_time,
+    f_number, iso, focal_length, latitude, longitude, orientation
+FROM photo_metadata
+WHERE photo_id = sqlc.arg('photo_id')
+ON CONFLICT (photo_id) DO NOTHING;
 
--- name: UpdatePhotosPostId :exec
+-- name: UpdatePhotosPostId :many
+-- moves the user's photos from their other posts in the family, they go after the photos already there.
+-- returns the post each photo came from
+UPDATE photos AS ph
+SET post_id = sqlc.arg('post_id'), sort_order = NULL, updated_at = NOW()
+FROM posts AS p
+WHERE ph.post_id = p.id AND ph.id = ANY(sqlc.arg('ids')::text[])
+    AND ph.user_id = sqlc.arg('user_id') AND ph.deleted_at IS NULL
+    AND p.family_id = sqlc.arg('family_id') AND p.deleted_at IS NULL
+RETURNING p.id;
+
+-- name: SetPhotosSortOrder :exec
+-- numbers the photos of a post in the order of ids
 UPDATE photos
-SET post_id = $1
-WHERE id = ANY($2::string[]);
+SET sort_order = array_position(sqlc.arg('ids')::text[], id)
+WHERE post_id = sqlc.arg('post_id') AND id = ANY(sqlc.arg('ids')::text[]);
+
+-- name: GetUserPhotosOutsidePost :many
+SELECT ph.id, ph.name, ph.media_type, ph.thumb_url <> ph.url AS has_preview
+FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+WHERE ph.user_id = $1 AND p.family_id = $2 AND ph.post_id <> $3
+    AND ph.deleted_at IS NULL AND p.deleted_at IS NULL
+ORDER BY ph.created_at DESC
+LIMIT $4;
+
+-- name: GetFamilyMedia :one
+-- trashed photos can only be seen by their owner, in the trash
+SELECT ph.* FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+    WHERE ph.id=$1 AND p.family_id=$2
+        AND ((ph.deleted_at IS NULL AND p.deleted_at IS NULL) OR ph.user_id=$3);
+
+-- name: TrashPhoto :execrows
+UPDATE photos SET deleted_at = NOW()
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL;
+
+-- name: RestorePhoto :execrows
+UPDATE photos SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL;
+
+-- name: GetTrashedPhotos :many
+-- photos of a trashed post are restored with it, so they are left out
+SELECT ph.id, ph.media_type, ph.thumb_url <> ph.url AS has_preview, ph.deleted_at, p.description AS post_description
+FROM photos AS ph
+    JOIN posts AS p ON ph.post_id = p.id
+WHERE ph.user_id = $1 AND p.family_id = $2 AND ph.deleted_at IS NOT NULL AND p.deleted_at IS NULL
+ORDER BY ph.deleted_at DESC;
+
+-- name: PurgeDeletedPhotos :many
+DELETE FROM photos AS ph
+USING posts AS p
+WHERE ph.post_id = p.id
+    AND (ph.deleted_at < sqlc.arg('before')::timestamp OR p.deleted_at < sqlc.arg('before')::timestamp)
+RETURNING ph.url, ph.thumb_url, ph.medium_url;
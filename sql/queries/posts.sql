@@ -1,12 +1,92 @@
--- name: GetPost :one
-SELECT * FROM posts
-WHERE id=$1
-LIMIT 1;
-
 -- name: CreatePost :one
-INSERT INTO posts (description, featured_photo_id, user_id, family_id, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO posts (description, featured_photo_id, user_id, family_id)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetOrCreateBatchPost :one
+INSERT INTO posts (description, user_id, family_id, upload_batch)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, upload_batch) DO UPDATE SET updated_at = NOW()
+RETURNING *;
+
+-- name: GetFamilyPostAggregated :one
+SELECT
+    p.id AS post_id,
+    p.created_at AS post_created_at,
+    p.updated_at AS post_updated_at,
+    p.description AS post_description,
+    p.featured_photo_id AS post_featured_photo_id,
+    p.user_id = $3 AS is_my_post,
+    u.name AS user_name,
+    f.name AS family_name,
+    (SELECT COUNT(*) FROM comments AS c WHERE c.post_id = p.id) AS comment_count,
+    (SELECT json_agg(json_build_object('emoji', r.emoji, 'count', r.count, 'users', r.users, 'mine', r.mine) ORDER BY r.first_at)
+        FROM (
+            SELECT re.emoji, COUNT(*) AS count, json_agg(ru.name ORDER BY re.created_at) AS users,
+                bool_or(re.user_id = $3) AS mine, MIN(re.created_at) AS first_at
+            FROM reactions AS re
+                JOIN users AS ru ON re.user_id = ru.id
+            WHERE re.post_id = p.id
+            GROUP BY re.emoji
+        ) AS r) AS reactions,
+    json_arrayagg(json_build_object(
+        'photo_id', ph.id,
+        'photo_name', ph.name,
+        'photo_url', ph.url,
+        'photo_thumb_url', ph.thumb_url,
+        'photo_medium_url', ph.medium_url,
+        'media_type', ph.media_type,
+        'has_preview', ph.thumb_url <> ph.url
+    ) ORDER BY ph.id = p.featured_photo_id DESC, ph.sort_order ASC NULLS LAST, ph.modified_at ASC) AS photos
+FROM 
+    posts p
+JOIN 
+    users u ON p.user_id = u.id
+JOIN 
+    families f ON p.family_id = f.id
+JOIN 
+    photos ph ON ph.post_id = p.id AND ph.deleted_at IS NULL
+WHERE 
+    p.id = $1 AND p.family_id = $2 AND p.deleted_at IS NULL
+GROUP BY 
+    p.id, u.name, f.name;
+
+-- name: UpdatePost :one
+UPDATE posts
+SET description = $3, featured_photo_id = $4, updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
 RETURNING *;
 
--- name: GetPostsByUserFamily :many
--- SELECT p.*, u.name as user_name, p.user_id = $1 AS is_my_photo
+-- name: TrashPost :execrows
+UPDATE posts SET deleted_at = NOW()
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL;
+
+-- name: TrashEmptyPosts :execrows
+-- trashes those of the user's posts that have no photos left
+UPDATE posts AS p SET deleted_at = NOW()
+WHERE p.id = ANY(sqlc.arg('ids')::bigint[]) AND p.user_id = sqlc.arg('user_id') AND p.deleted_at IS NULL
+    AND NOT EXISTS (SELECT 1 FROM photos AS ph WHERE ph.post_id = p.id AND ph.deleted_at IS NULL);
+
+-- name: ClearMovedFeaturedPhotos :exec
+-- a featured photo moved to another post no longer features in the one it left
+UPDATE posts AS p
+SET featured_photo_id = NULL
+WHERE p.user_id = $1 AND p.featured_photo_id IS NOT NULL AND NOT EXISTS (
+    SELECT 1 FROM photos AS ph WHERE ph.id = p.featured_photo_id AND ph.post_id = p.id
+);
+
+-- name: RestorePost :execrows
+UPDATE posts SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL;
+
+-- name: GetTrashedPosts :many
+SELECT p.id, p.description, p.deleted_at, COUNT(ph.id) AS photo_count
+FROM posts AS p
+    LEFT JOIN photos AS ph ON ph.post_id = p.id AND ph.deleted_at IS NULL
+WHERE p.user_id = $1 AND p.family_id = $2 AND p.deleted_at IS NOT NULL
+GROUP BY p.id
+ORDER BY p.deleted_at DESC;
+
+-- name: PurgeDeletedPosts :execrows
+DELETE FROM posts
+WHERE deleted_at < sqlc.arg('before')::timestamp;
@@ -0,0 +1,17 @@
+-- name: CreatePostReaction :exec
+INSERT INTO reactions (post_id, user_id, emoji, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeletePostReaction :execrows
+DELETE FROM reactions
+WHERE post_id = $1 AND user_id = $2 AND emoji = $3;
+
+-- name: CreatePhotoReaction :exec
+INSERT INTO reactions (photo_id, user_id, emoji, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeletePhotoReaction :execrows
+DELETE FROM reactions
+WHERE photo_id = $1 AND user_id = $2 AND emoji = $3;
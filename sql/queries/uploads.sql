@@ -0,0 +1,29 @@
+-- name: AppendUploadChunk :execrows
+-- records a chunk stored at the offset the upload is at, nothing changes when another request got there first
+UPDATE uploads
+SET upload_offset = upload_offset + sqlc.arg('size'), chunks = array_append(chunks, sqlc.arg('chunk')::text)
+WHERE id = sqlc.arg('id') AND upload_offset = sqlc.arg('upload_offset') AND completed_at IS NULL;
+
+-- name: CompleteUpload :execrows
+UPDATE uploads
+SET completed_at = NOW(), chunks = '{}'
+WHERE id = $1 AND completed_at IS NULL;
+
+-- name: CreateUpload :one
+INSERT INTO uploads (id, user_id, family_id, length, batch, caption, filename, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), $8)
+RETURNING *;
+
+-- name: DeleteExpiredUploads :many
+DELETE FROM uploads
+WHERE expires_at <= NOW()
+RETURNING chunks;
+
+-- name: DeleteUpload :one
+DELETE FROM uploads
+WHERE id = $1 AND user_id = $2
+RETURNING chunks;
+
+-- name: GetUpload :one
+SELECT * FROM uploads
+WHERE id = $1 AND user_id = $2 AND expires_at > NOW();
@@ -1,6 +1,6 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, name, apikey, password, family_id)
-VALUES ($1, NOW(), NOW(), $2, encode(sha256(random()::text::bytea), 'hex'), $3, $4)
+INSERT INTO users (id, created_at, updated_at, name, password, family_id)
+VALUES ($1, NOW(), NOW(), $2, $3, $4)
 RETURNING *;
 
 -- name: GetUserByID :one
@@ -11,7 +11,33 @@ WHERE ID = $1;
 select * FROM users 
 WHERE name=$1;
 
+-- name: GetUserByApiKey :one
+SELECT * FROM users
+WHERE apikey_hash=$1;
+
+-- name: UpdateUserApiKey :exec
+UPDATE users
+SET apikey_hash = $2, updated_at = NOW()
+WHERE id = $1;
+
 -- name: GetUsersByFamily :many
-SELECT id, name FROM users
-WHERE family_id=$1
-ORDER BY created_at ASC;
+SELECT u.id, u.name, m.created_at, (m.role = 'admin')::boolean AS is_admin
+    FROM family_memberships AS m
+    JOIN users AS u ON m.user_id = u.id
+    WHERE m.family_id=$1
+    ORDER BY m.created_at ASC;
+
+-- name: SetUserFamily :exec
+UPDATE users
+SET family_id = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ReselectUserFamily :exec
+UPDATE users
+SET family_id = (
+    SELECT m.family_id FROM family_memberships AS m
+        WHERE m.user_id = users.id
+        ORDER BY m.created_at ASC
+        LIMIT 1
+), updated_at = NOW()
+WHERE id = $1 AND family_id = $2;
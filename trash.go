@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/donseba/go-htmx"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/rowinf/phamily-photos/internal/database"
+)
+
+// trashRetention is how long deleted photos and posts can be restored before they are purged
+const trashRetention = 30 * 24 * time.Hour
+
+// trashPurgeInterval is how often the trash is checked for things past their retention
+const trashPurgeInterval = time.Hour
+
+// trashRestoredEvent is triggered after something is taken out of the trash, so the trash list reloads
+const trashRestoredEvent = "trashRestored"
+
+// TrashGet lists the photos and posts the user deleted in the selected family, with how long is left
+// to restore them
+func (a *App) TrashGet(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	photos, err := a.DB.GetTrashedPhotos(r.Context(), database.GetTrashedPhotosParams{
+		UserID:   user.ID,
+		FamilyID: user.FamilyID.Int64,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	posts, err := a.DB.GetTrashedPosts(r.Context(), database.GetTrashedPostsParams{
+		UserID:   user.ID,
+		FamilyID: user.FamilyID.Int64,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data := map[string]any{
+		"Photos": photos,
+		"Posts":  posts,
+	}
+	component := htmx.NewComponent("views/trash.html").SetData(data)
+	component.AddTemplateFunction("formatDate", formatDate)
+	component.AddTemplateFunction("daysLeft", daysLeft)
+	// the list reloads itself after a restore, anything else gets the whole page
+	page := component
+	if !h.IsHxRequest() || h.IsHxBoosted() {
+		page = mainContentWithNavbar("Phamily Photos Trash", a.navbarWithUser(r.Context(), user))
+		page.With(component, "Content")
+	}
+	_, err = h.Render(r.Context(), page)
+	if err != nil {
+		fmt.Printf("error rendering page: %v", err.Error())
+	}
+}
+
+// daysLeft is how many days remain before something deleted at deletedAt is purged, rounded up
+func daysLeft(deletedAt time.Time) int {
+	left := time.Until(deletedAt.Add(trashRetention))
+	return max(0, int((left+24*time.Hour-1)/(24*time.Hour)))
+}
+
+// PhotoRestore takes one of the user's photos out of the trash, back into its post
+func (a *App) PhotoRestore(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	rows, err := a.DB.RestorePhoto(r.Context(), database.RestorePhotoParams{
+		ID:     r.PathValue("photoID"),
+		UserID: user.ID,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rows == 0 {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	h.Trigger(trashRestoredEvent)
+	h.TriggerInfo("The photo was restored")
+	internal.RespondWithOk(w)
+}
+
+// PostRestore takes one of the user's posts out of the trash, with the photos it had when it was deleted
+func (a *App) PostRestore(w http.ResponseWriter, r *http.Request, user database.User) {
+	h := a.htmx.NewHandler(w, r)
+	postID, err := strconv.ParseInt(r.PathValue("postID"), 10, 64)
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	rows, err := a.DB.RestorePost(r.Context(), database.RestorePostParams{
+		ID:     postID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		internal.RespondWithErrorHtmx(h, w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rows == 0 {
+		internal.RespondWithErrorHtmx(h, w, http.StatusNotFound, "not found")
+		return
+	}
+	h.Trigger(trashRestoredEvent)
+	h.TriggerInfo("The post was restored")
+	internal.RespondWithOk(w)
+}
+
+// purgeTrash removes what has been in the trash past its retention, every interval until ctx is done
+func (a *App) purgeTrash(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		a.purgeExpiredTrash(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeExpiredTrash deletes the photos and posts deleted before the retention window, and the files
+// no other photo uses
+func (a *App) purgeExpiredTrash(ctx context.Context) {
+	before := pgtype.Timestamp{Time: time.Now().Add(-trashRetention), Valid: true}
+	// photos go first, deleting a post would take its photos without saying which files they used
+	photos, err := a.DB.PurgeDeletedPhotos(ctx, before)
+	if err != nil {
+		log.Printf("error purging deleted photos: %v", err)
+		return
+	}
+	if _, err := a.DB.PurgeDeletedPosts(ctx, before); err != nil {
+		log.Printf("error purging deleted posts: %v", err)
+	}
+	for _, photo := range photos {
+		a.deleteUnusedBlobs(ctx, photo.Url, photo.ThumbUrl, photo.MediumUrl)
+	}
+	if len(photos) > 0 {
+		log.Printf("purged %d photos from the trash", len(photos))
+	}
+}
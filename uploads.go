@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/rowinf/phamily-photos/internal"
+	"github.com/rowinf/phamily-photos/internal/database"
+)
+
+// uploadExpiry is how long a resumable upload can take before what arrived is thrown away
+const uploadExpiry = 24 * time.Hour
+
+const tusExtensions = "creation,expiration,termination"
+
+var errUploadCompleted = errors.New("UPLOAD_COMPLETED")
+
+// tusHeaders are sent on every upload response, clients check them to know they are talking tus
+func tusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", internal.TusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// tusResumable refuses requests from clients speaking another version of the protocol
+func tusResumable(w http.ResponseWriter, r *http.Request) bool {
+	tusHeaders(w)
+	if r.Header.Get("Tus-Resumable") != internal.TusVersion {
+		w.Header().Set("Tus-Version", internal.TusVersion)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+func uploadHeaders(w http.ResponseWriter, upload database.Upload, offset int64) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Time.UTC().Format(http.TimeFormat))
+}
+
+// UploadOptions tells tus clients what the server supports, it needs no login
+func (a *App) UploadOptions(w http.ResponseWriter, r *http.Request) {
+	tusHeaders(w)
+	w.Header().Set("Tus-Version", internal.TusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(internal.MaxVideoUploadSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uploadSizeLimit is the largest file an upload can declare. Only uploads that say they are a video,
+// by their filetype or filename, get the video limit, SaveFile checks what the file turns out to be.
+func uploadSizeLimit(meta map[string]string) int64 {
+	filetype := meta["filetype"]
+	if filetype == "" {
+		filetype, _, _ = strings.Cut(mime.TypeByExtension(strings.ToLower(filepath.Ext(meta["filename"]))), ";")
+	}
+	if internal.IsVideo(filetype) {
+		return internal.MaxVideoUploadSize
+	}
+	return internal.MaxUploadSize
+}
+
+// UploadCreate starts a resumable upload of one file into the selected family. The Upload-Metadata
+// header can carry a filename, a caption and a batch, uploads sharing a batch are posted together.
+func (a *App) UploadCreate(w http.ResponseWriter, r *http.Request, user database.User) {
+	if !tusResumable(w, r) {
+		return
+	}
+	if !user.FamilyID.Valid {
+		internal.RespondWithError(w, http.StatusBadRequest, "no family")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		internal.RespondWithError(w, http.StatusBadRequest, "INVALID_UPLOAD_LENGTH")
+		return
+	}
+	meta, err := internal.ParseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		internal.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if length > uploadSizeLimit(meta) {
+		internal.RespondWithError(w, http.StatusRequestEntityTooLarge, internal.ErrFileTooBig.Error())
+		return
+	}
+	caption := strings.TrimSpace(meta["caption"])
+	if len(caption) > maxCaptionLength {
+		internal.RespondWithError(w, http.StatusBadRequest, errCaptionTooLong.Error())
+		return
+	}
+	// the file may turn out to be a duplicate, but one that can't fit is refused before it is sent
+	quota, err := a.newQuota(r.Context(), a.DB, user.FamilyID.Int64)
+	if err != nil {
+		internal.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !quota.fits(length) {
+		internal.RespondWithError(w, http.StatusRequestEntityTooLarge, internal.ErrQuotaExceeded.Error())
+		return
+	}
+	a.removeExpiredUploads(r.Context())
+
+	id := internal.NewUploadID()
+	batch := meta["batch"]
+	if batch == "" {
+		batch = id
+	}
+	upload, err := a.DB.CreateUpload(r.Context(), database.CreateUploadParams{
+		ID:        id,
+		UserID:    user.ID,
+		FamilyID:  user.FamilyID.Int64,
+		Length:    length,
+		Batch:     batch,
+		Caption:   caption,
+		Filename:  meta["filename"],
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().Add(uploadExpiry), Valid: true},
+	})
+	if err != nil {
+		internal.RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/v1/uploads/"+id)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Time.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// uploadOffset is how much of the upload the server has, all of it once it became a photo
+func uploadOffset(upload database.Upload) int64 {
+	if upload.CompletedAt.Valid {
+		return upload.Length
+	}
+	return upload.UploadOffset
+}
+
+// UploadHead reports how far an upload got, so the client knows where to resume
+func (a *App) UploadHead(w http.ResponseWriter, r *http.Request, user database.User) {
+	if !tusResumable(w, r) {
+		return
+	}
+	upload, err := a.DB.GetUpload(r.Context(), database.GetUploadParams{
+		ID:     r.PathValue("uploadID"),
+		UserID: user.ID,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	uploadHeaders(w, upload, uploadOffset(upload))
+	w.WriteHeader(http.StatusOK)
+}
+
+// UploadPatch appends a chunk at the offset the client says it is at. The chunk that completes
+// the upload turns it into a photo, the same way a file sent to PhotoCreate is.
+func (a *App) UploadPatch(w http.ResponseWriter, r *http.Request, user database.User) {
+	if !tusResumable(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		internal.RespondWithError(w, http.StatusUnsupportedMediaType, "INVALID_CONTENT_TYPE")
+		return
+	}
+	upload, err := a.DB.GetUpload(r.Context(), database.GetUploadParams{
+		ID:     r.PathValue("uploadID"),
+		UserID: user.ID,
+	})
+	if err != nil {
+		internal.RespondWithError(w, http.StatusNotFound, "not found")
+		return
+	}
+	offset := uploadOffset(upload)
+	if r.Header.Get("Upload-Offset") != strconv.FormatInt(offset, 10) {
+		uploadHeaders(w, upload, offset)
+		internal.RespondWithError(w, http.StatusConflict, "OFFSET_MISMATCH")
+		return
+	}
+
+	if !upload.CompletedAt.Valid {
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Now().Add(uploadTimeout))
+		rc.SetWriteDeadline(time.Now().Add(uploadTimeout))
+		chunk, err := a.Partials.Append(r.Context(), upload.ID, offset, r.Body, upload.Length-offset)
+		if chunk.Key != "" {
+			// the offset only moves for one of the requests sending a chunk at it, on whichever instance
+			rows, dbErr := a.DB.AppendUploadChunk(context.WithoutCancel(r.Context()), database.AppendUploadChunkParams{
+				Size:         chunk.Size,
+				Chunk:        chunk.Key,
+				ID:           upload.ID,
+				UploadOffset: offset,
+			})
+			if dbErr != nil || rows == 0 {
+				if err := a.Partials.Remove(context.WithoutCancel(r.Context()), []string{chunk.Key}); err != nil {
+					log.Printf("error removing chunk of upload %s: %v", upload.ID, err)
+				}
+			}
+			if dbErr != nil {
+				internal.RespondWithError(w, http.StatusInternalServerError, dbErr.Error())
+				return
+			}
+			if rows == 0 {
+				internal.RespondWithError(w, http.StatusConflict, "OFFSET_MISMATCH")
+				return
+			}
+			offset += chunk.Size
+			upload.Chunks = append(upload.Chunks, chunk.Key)
+		}
+		if err != nil {
+			// what did arrive is kept, the client asks for the offset and carries on from there
+			log.Printf("upload %s interrupted at %d of %d bytes: %v", upload.ID, offset, upload.Length, err)
+			uploadHeaders(w, upload, offset)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	if offset == upload.Length && !upload.CompletedAt.Valid {
+		formErr, err := a.completeUpload(r.Context(), user, upload)
+		if formErr != nil {
+			internal.RespondWithError(w, http.StatusUnprocessableEntity, formErr.Error())
+			return
+		}
+		if err != nil {
+			internal.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	uploadHeaders(w, upload, offset)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeUpload saves a finished upload and adds it to its batch's post. A file that is refused is
+// an error for the client, the upload is dropped as resuming it won't help.
+func (a *App) completeUpload(ctx context.Context, user database.User, upload database.Upload) (formErr error, err error) {
+	family, err := a.DB.GetFamilyById(ctx, upload.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	file := a.Partials.Open(ctx, upload.Chunks)
+	defer file.Close()
+	saved, err := internal.SaveFile(ctx, a.Storage, file, internal.LocationPolicy(family.LocationExif), a.findFamilyUpload(ctx, a.DB, family.ID))
+	if err == nil {
+		quota, qerr := a.newQuota(ctx, a.DB, family.ID)
+		if qerr != nil {
+			a.discardSaved(ctx, saved)
+			return nil, qerr
+		}
+		if err = quota.take(saved); err != nil {
+			a.discardSaved(ctx, saved)
+		}
+	}
+	var uploadErr *internal.UploadError
+	if errors.As(err, &uploadErr) {
+		a.discardUpload(ctx, user, upload.ID)
+		return uploadErr, nil
+	}
+	// anything else, like storage being unreachable, is worth another try with the same upload
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.withTx(ctx, func(txq *database.Queries) error {
+		post, err := txq.GetOrCreateBatchPost(ctx, database.GetOrCreateBatchPostParams{
+			Description: upload.Caption,
+			UserID:      user.ID,
+			FamilyID:    family.ID,
+			UploadBatch: pgtype.Text{String: upload.Batch, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if err := a.createPhoto(ctx, txq, user, family, post.ID, saved); err != nil {
+			return err
+		}
+		// another request may have completed the same upload meanwhile, its photo is the one kept
+		rows, err := txq.CompleteUpload(ctx, upload.ID)
+		if err == nil && rows == 0 {
+			err = errUploadCompleted
+		}
+		return err
+	})
+	if err != nil {
+		a.discardSaved(ctx, saved)
+		if errors.Is(err, errUploadCompleted) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// the row stays until it expires so a client that missed the response still sees it as complete
+	if err := a.Partials.Remove(ctx, upload.Chunks); err != nil {
+		log.Printf("error removing upload %s: %v", upload.ID, err)
+	}
+	return nil, nil
+}
+
+// UploadDelete abandons an upload, throwing away what arrived so far
+func (a *App) UploadDelete(w http.ResponseWriter, r *http.Request, user database.User) {
+	if !tusResumable(w, r) {
+		return
+	}
+	if !a.discardUpload(r.Context(), user, r.PathValue("uploadID")) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// discardUpload removes one of the user's uploads, ok is false when they have no such upload
+func (a *App) discardUpload(ctx context.Context, user database.User, id string) (ok bool) {
+	chunks, err := a.DB.DeleteUpload(ctx, database.DeleteUploadParams{
+		ID:     id,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return false
+	}
+	if err := a.Partials.Remove(ctx, chunks); err != nil {
+		log.Printf("error removing upload %s: %v", id, err)
+	}
+	return true
+}
+
+// removeExpiredUploads throws away uploads nobody finished in time
+func (a *App) removeExpiredUploads(ctx context.Context) {
+	expired, err := a.DB.DeleteExpiredUploads(ctx)
+	if err != nil {
+		log.Printf("error removing expired uploads: %v", err)
+		return
+	}
+	for _, chunks := range expired {
+		if err := a.Partials.Remove(ctx, chunks); err != nil {
+			log.Printf("error removing expired upload: %v", err)
+		}
+	}
+}